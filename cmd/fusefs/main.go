@@ -5,8 +5,7 @@ import (
 	"net/http"
 	"time"
 
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/example/fuses3redispostgres/internal/cache"
 	"github.com/example/fuses3redispostgres/internal/config"
 	"github.com/example/fuses3redispostgres/internal/fusefs"
 	"github.com/example/fuses3redispostgres/internal/logging"
@@ -28,13 +27,26 @@ func main() {
 	ctx := context.Background()
 	pg, _ := pgxpool.New(ctx, cfg.PostgresDSN)
 	rdb := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr, Password: cfg.RedisPassword, DB: cfg.RedisDB})
-	awsCfg, _ := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cfg.S3Region))
-	s3c := s3.NewFromConfig(awsCfg)
+	backends, err := s3io.NewBackends(ctx, cfg)
+	if err != nil {
+		panic(err)
+	}
 	repo := metadata.NewRepository(pg)
 	resolver := metadata.NewResolver(repo, rdb, 50000, 30*time.Minute)
-	reader := s3io.NewReader(s3c, cfg.GlobalS3Limit, cfg.PerBucketS3Limit)
-	root := fusefs.NewRoot(resolver, reader, cfg.BlockSizeBytes, cfg.PrefetchSizeByte)
-	server, err := fs.Mount(cfg.FuseMountPoint, root, &fs.Options{MountOptions: fuse.MountOptions{FsName: "virtualfs", Name: "virtualfs", ReadOnly: true}})
+	go resolver.Watch(ctx)
+	reader := s3io.NewReader(backends, cfg.GlobalS3Limit, cfg.PerBucketS3Limit)
+	reader.Adapt(cfg.PerBucketS3Min, cfg.PerBucketS3Max)
+	reader.Retry(s3io.RetryPolicyFrom(cfg))
+	reader.CacheRanges(cfg.MemCacheBytes, cfg.MemCacheTTL)
+	reader.Buffers(cfg.BlockSizeBytes, cfg.BufferMemoryBytes)
+	var dc *cache.Disk
+	if cfg.CacheSizeBytes > 0 {
+		if dc, err = cache.NewDisk(cfg.CacheDir, cfg.CacheSizeBytes); err != nil {
+			panic(err)
+		}
+	}
+	root := fusefs.NewRoot(cfg, resolver, repo, reader, dc)
+	server, err := fs.Mount(cfg.FuseMountPoint, root, &fs.Options{MountOptions: fuse.MountOptions{FsName: "virtualfs", Name: "virtualfs", Options: []string{"ro"}}})
 	if err != nil {
 		panic(err)
 	}
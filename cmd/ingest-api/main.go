@@ -5,12 +5,13 @@ import (
 	"net/http"
 	"time"
 
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/example/fuses3redispostgres/internal/api"
 	"github.com/example/fuses3redispostgres/internal/config"
 	"github.com/example/fuses3redispostgres/internal/logging"
 	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/example/fuses3redispostgres/internal/placement"
+	"github.com/example/fuses3redispostgres/internal/purge"
+	"github.com/example/fuses3redispostgres/internal/s3io"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 )
@@ -27,11 +28,28 @@ func main() {
 		panic(err)
 	}
 	rdb := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr, Password: cfg.RedisPassword, DB: cfg.RedisDB})
-	awsCfg, _ := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cfg.S3Region))
-	s3c := s3.NewFromConfig(awsCfg)
+	backends, err := s3io.NewBackends(ctx, cfg)
+	if err != nil {
+		panic(err)
+	}
 	repo := metadata.NewRepository(pg)
 	resolver := metadata.NewResolver(repo, rdb, 10000, 10*time.Minute)
-	srv := api.New(cfg, log, repo, resolver, s3c, rdb)
+	reader := s3io.NewReader(backends, cfg.GlobalS3Limit, cfg.PerBucketS3Limit)
+	reader.Adapt(cfg.PerBucketS3Min, cfg.PerBucketS3Max)
+	reader.Retry(s3io.RetryPolicyFrom(cfg))
+	reader.CacheRanges(cfg.MemCacheBytes, cfg.MemCacheTTL)
+	reader.Buffers(cfg.BlockSizeBytes, cfg.BufferMemoryBytes)
+	place, err := placement.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	srv := api.New(cfg, log, repo, resolver, backends, reader, rdb, place)
+	go resolver.Watch(ctx)
+	go srv.SweepUploads(ctx, 10*time.Minute)
+	if cfg.PurgeInterval > 0 {
+		purger := &purge.Purger{Repo: repo, Store: backends, Log: log, Grace: cfg.PurgeGracePeriod}
+		go purger.Run(ctx, cfg.PurgeInterval)
+	}
 	log.Info("ingest-api listening")
 	if err := http.ListenAndServe(cfg.HTTPAddr, srv.Router()); err != nil {
 		panic(err)
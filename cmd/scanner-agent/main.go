@@ -21,7 +21,7 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	agent := &scanner.Agent{Dirs: cfg.ScanDirs, APIBaseURL: "http://localhost:8080", APIKey: cfg.APIKey, DB: db, Log: log, Limit: rate.NewLimiter(rate.Limit(10), 20), Workers: 4}
+	agent := &scanner.Agent{Dirs: cfg.ScanDirs, APIBaseURL: "http://localhost:8080", APIKey: cfg.APIKey, DB: db, Log: log, Limit: rate.NewLimiter(rate.Limit(10), 20), Workers: 4, PartSize: cfg.UploadPartSize, MultipartThreshold: cfg.MultipartThreshold}
 	go http.ListenAndServe(":18080", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200); _, _ = w.Write([]byte("ok")) }))
 	for {
 		if err := agent.RunOnce(); err != nil {
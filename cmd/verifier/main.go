@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/config"
+	"github.com/example/fuses3redispostgres/internal/logging"
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/example/fuses3redispostgres/internal/s3io"
+	"github.com/example/fuses3redispostgres/internal/verifier"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+)
+
+func main() {
+	cfg, err := config.Load("")
+	if err != nil {
+		panic(err)
+	}
+	log, _ := logging.New(cfg.LogLevel)
+	ctx := context.Background()
+	pg, err := pgxpool.New(ctx, cfg.PostgresDSN)
+	if err != nil {
+		panic(err)
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr, Password: cfg.RedisPassword, DB: cfg.RedisDB})
+	backends, err := s3io.NewBackends(ctx, cfg)
+	if err != nil {
+		panic(err)
+	}
+	repo := metadata.NewRepository(pg)
+	resolver := metadata.NewResolver(repo, rdb, 10000, 10*time.Minute)
+	reader := s3io.NewReader(backends, cfg.GlobalS3Limit, cfg.PerBucketS3Limit)
+	reader.Adapt(cfg.PerBucketS3Min, cfg.PerBucketS3Max)
+	reader.Retry(s3io.RetryPolicyFrom(cfg))
+	go http.ListenAndServe(cfg.MetricsAddr, promhttp.Handler())
+	v := &verifier.Verifier{Repo: repo, Resolver: resolver, Reader: reader, Log: log, MaxAge: cfg.VerifyMaxAge}
+	log.Info("verifier started")
+	v.Run(ctx, cfg.VerifyInterval)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// expectedDigests holds the digests a client declared for an upload body.
+// A nil field means the client did not send that digest.
+type expectedDigests struct {
+	md5    []byte
+	sha256 []byte
+}
+
+// digestMismatch is returned in place of io.EOF when the body does not match
+// a declared digest, so the S3 upload fails before it is completed.
+type digestMismatch struct {
+	digest   string
+	expected string
+	actual   string
+}
+
+func (e *digestMismatch) Error() string {
+	return fmt.Sprintf("%s mismatch: expected %s, got %s", e.digest, e.expected, e.actual)
+}
+
+// parseDigests reads Content-MD5 (base64), X-Checksum-SHA256 (hex or base64)
+// and the RFC 3230 Digest header (md5=, sha-256=). Conflicting values for the
+// same algorithm are rejected.
+func parseDigests(h http.Header) (expectedDigests, error) {
+	var d expectedDigests
+	if v := h.Get("Content-MD5"); v != "" {
+		b, err := decodeDigest(v, md5.Size)
+		if err != nil {
+			return d, fmt.Errorf("invalid Content-MD5: %w", err)
+		}
+		d.md5 = b
+	}
+	if v := h.Get("X-Checksum-SHA256"); v != "" {
+		b, err := decodeDigest(v, sha256.Size)
+		if err != nil {
+			return d, fmt.Errorf("invalid X-Checksum-SHA256: %w", err)
+		}
+		d.sha256 = b
+	}
+	for _, item := range strings.Split(h.Get("Digest"), ",") {
+		alg, val, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			continue
+		}
+		var dst *[]byte
+		var size int
+		switch strings.ToLower(alg) {
+		case "md5":
+			dst, size = &d.md5, md5.Size
+		case "sha-256":
+			dst, size = &d.sha256, sha256.Size
+		default:
+			continue
+		}
+		b, err := decodeDigest(val, size)
+		if err != nil {
+			return d, fmt.Errorf("invalid Digest %s: %w", alg, err)
+		}
+		if *dst != nil && !bytes.Equal(*dst, b) {
+			return d, fmt.Errorf("conflicting %s digests", alg)
+		}
+		*dst = b
+	}
+	return d, nil
+}
+
+func checksumMismatch(c *gin.Context, m *digestMismatch) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "checksum mismatch", "digest": m.digest, "expected": m.expected, "actual": m.actual})
+}
+
+func decodeDigest(v string, size int) ([]byte, error) {
+	v = strings.TrimSpace(v)
+	if len(v) == hex.EncodedLen(size) {
+		if b, err := hex.DecodeString(v); err == nil {
+			return b, nil
+		}
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || len(b) != size {
+		return nil, errors.New("expected hex or base64 digest")
+	}
+	return b, nil
+}
+
+// verifyingReader hashes and counts the body as it is read and checks it
+// against the expected digests at EOF.
+type verifyingReader struct {
+	r      io.Reader
+	want   expectedDigests
+	md5    hash.Hash
+	sha256 hash.Hash
+	n      int64
+}
+
+func newVerifyingReader(r io.Reader, want expectedDigests) *verifyingReader {
+	return &verifyingReader{r: r, want: want, md5: md5.New(), sha256: sha256.New()}
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.n += int64(n)
+	v.md5.Write(p[:n])
+	v.sha256.Write(p[:n])
+	if err == io.EOF {
+		if merr := v.check(); merr != nil {
+			return n, merr
+		}
+	}
+	return n, err
+}
+
+func (v *verifyingReader) check() *digestMismatch {
+	if v.want.md5 != nil {
+		if got := v.md5.Sum(nil); !bytes.Equal(got, v.want.md5) {
+			return &digestMismatch{digest: "md5", expected: hex.EncodeToString(v.want.md5), actual: hex.EncodeToString(got)}
+		}
+	}
+	if v.want.sha256 != nil {
+		if got := v.sha256.Sum(nil); !bytes.Equal(got, v.want.sha256) {
+			return &digestMismatch{digest: "sha256", expected: hex.EncodeToString(v.want.sha256), actual: hex.EncodeToString(got)}
+		}
+	}
+	return nil
+}
+
+func (v *verifyingReader) md5Hex() string    { return hex.EncodeToString(v.md5.Sum(nil)) }
+func (v *verifyingReader) sha256Hex() string { return hex.EncodeToString(v.sha256.Sum(nil)) }
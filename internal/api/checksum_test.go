@@ -0,0 +1,47 @@
+package api
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseDigests(t *testing.T) {
+	body := "hello"
+	m := md5.Sum([]byte(body))
+	s := sha256.Sum256([]byte(body))
+	h := http.Header{}
+	h.Set("Content-MD5", base64.StdEncoding.EncodeToString(m[:]))
+	h.Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(s[:]))
+	d, err := parseDigests(h)
+	if err != nil || d.md5 == nil || d.sha256 == nil {
+		t.Fatalf("parse: %+v %v", d, err)
+	}
+	h.Set("X-Checksum-SHA256", hex.EncodeToString(make([]byte, sha256.Size)))
+	if _, err := parseDigests(h); err == nil {
+		t.Fatal("expected conflicting digests to be rejected")
+	}
+	if _, err := parseDigests(http.Header{"Content-Md5": {"nope"}}); err == nil {
+		t.Fatal("expected invalid Content-MD5 to be rejected")
+	}
+}
+
+func TestVerifyingReader(t *testing.T) {
+	s := sha256.Sum256([]byte("hello"))
+	r := newVerifyingReader(strings.NewReader("hello"), expectedDigests{sha256: s[:]})
+	if _, err := io.ReadAll(r); err != nil || r.n != 5 {
+		t.Fatalf("matching body: n=%d err=%v", r.n, err)
+	}
+	r = newVerifyingReader(strings.NewReader("hellO"), expectedDigests{sha256: s[:]})
+	_, err := io.ReadAll(r)
+	var mismatch *digestMismatch
+	if !errors.As(err, &mismatch) || mismatch.digest != "sha256" {
+		t.Fatalf("expected sha256 mismatch, got %v", err)
+	}
+}
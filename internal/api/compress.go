@@ -0,0 +1,60 @@
+package api
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/example/fuses3redispostgres/internal/decompress"
+	"github.com/gin-gonic/gin"
+)
+
+// compression returns the codec an upload is stored with: the compress query
+// parameter or X-Compress header ("zstd" or "none") when given, otherwise the
+// placement policy's PLACEMENT_COMPRESS.
+func (s *Server) compression(c *gin.Context) (string, error) {
+	v := c.Query("compress")
+	if v == "" {
+		v = c.GetHeader("X-Compress")
+	}
+	switch v {
+	case "":
+		return s.placement.Compression(), nil
+	case "none":
+		return "", nil
+	case string(decompress.Zstd):
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown compression %q", v)
+}
+
+// compressingReader yields the zstd seekable encoding of src, counting the
+// bytes it produced. An error from src, such as a digest mismatch, is
+// returned by Read unchanged.
+type compressingReader struct {
+	pr *io.PipeReader
+	n  int64
+}
+
+func newCompressingReader(src io.Reader) *compressingReader {
+	pr, pw := io.Pipe()
+	go func() {
+		zw, err := decompress.NewWriter(pw, decompress.DefaultFrameSize)
+		if err == nil {
+			_, err = io.Copy(zw, src)
+		}
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return &compressingReader{pr: pr}
+}
+
+func (r *compressingReader) Read(p []byte) (int, error) {
+	n, err := r.pr.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// Close stops the encoder when the upload gave up before reading to the end.
+func (r *compressingReader) Close() error { return r.pr.Close() }
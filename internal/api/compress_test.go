@@ -0,0 +1,38 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/example/fuses3redispostgres/internal/decompress"
+)
+
+func TestCompressingReader(t *testing.T) {
+	text := strings.Repeat("2024-01-02T03:04:05Z INFO request served in 12ms\n", 20000)
+	s := sha256.Sum256([]byte(text))
+	body := newVerifyingReader(strings.NewReader(text), expectedDigests{sha256: s[:]})
+	r := newCompressingReader(body)
+	comp, err := io.ReadAll(r)
+	if err != nil || r.n != int64(len(comp)) || body.n != int64(len(text)) {
+		t.Fatalf("compress: n=%d of %d, %v", r.n, len(comp), err)
+	}
+	if len(comp)*10 > len(text) {
+		t.Fatalf("compressed %d bytes to %d", len(text), len(comp))
+	}
+	dec, _ := decompress.NewStreamReader(decompress.Zstd, bytes.NewReader(comp))
+	if got, err := io.ReadAll(dec); err != nil || string(got) != text {
+		t.Fatalf("round trip: %v", err)
+	}
+
+	body = newVerifyingReader(strings.NewReader(text+"x"), expectedDigests{sha256: s[:]})
+	r = newCompressingReader(body)
+	_, err = io.ReadAll(r)
+	var mismatch *digestMismatch
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected digest mismatch, got %v", err)
+	}
+}
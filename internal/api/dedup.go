@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (s *Server) dedupRequested(c *gin.Context) bool {
+	if raw := c.Query("dedup"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		return err == nil && v
+	}
+	return s.cfg.DedupEnabled
+}
+
+// dedup repoints obj at an existing S3 object with the same SHA-256 and size
+// and removes the copy that was just written. It reports whether it did. The
+// existing object may be stored compressed when obj is not, or the reverse.
+func (s *Server) dedup(ctx context.Context, obj *metadata.Object) bool {
+	existing, err := s.repo.FindBySHA256(ctx, *obj.ChecksumSHA, obj.LogicalSize())
+	if err != nil {
+		if !errors.Is(err, metadata.ErrNotFound) {
+			s.log.Warn("dedup lookup", zap.Error(err))
+		}
+		return false
+	}
+	if existing.Bucket == obj.Bucket && existing.Key == obj.Key && existing.Version() == obj.Version() {
+		return false
+	}
+	s.discardUpload(ctx, *obj)
+	obj.Bucket, obj.Key, obj.ETag, obj.VersionID, obj.Placement = existing.Bucket, existing.Key, existing.ETag, existing.VersionID, existing.Placement
+	obj.Size, obj.Codec, obj.OriginalSize = existing.Size, existing.Codec, existing.OriginalSize
+	return true
+}
+
+// discardUpload deletes a freshly written S3 object unless a row already
+// references the same key, which happens when the bucket is not versioned
+// and an earlier upload landed on the same key.
+func (s *Server) discardUpload(ctx context.Context, obj metadata.Object) {
+	if !s.unreferenced(ctx, obj) {
+		return
+	}
+	if err := s.store.Storage(obj.Bucket).Delete(ctx, obj.Bucket, obj.Key, obj.VersionID); err != nil {
+		s.log.Warn("delete duplicate upload", zap.String("bucket", obj.Bucket), zap.String("key", obj.Key), zap.Error(err))
+	}
+}
+
+// unreferenced reports whether a freshly written object may be deleted: a
+// versioned write is always our own, an unversioned key only when no row
+// points at it. A failed lookup keeps the object.
+func (s *Server) unreferenced(ctx context.Context, obj metadata.Object) bool {
+	return unreferenced(ctx, s.repo, obj)
+}
+
+type referenceCounter interface {
+	CountReferences(ctx context.Context, bucket, key string, versionID *string) (int64, error)
+}
+
+func unreferenced(ctx context.Context, refs referenceCounter, obj metadata.Object) bool {
+	if obj.VersionID != nil {
+		return true
+	}
+	n, err := refs.CountReferences(ctx, obj.Bucket, obj.Key, nil)
+	return err == nil && n == 0
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/fuses3redispostgres/internal/metadata"
+)
+
+type countRefs struct {
+	n     int64
+	err   error
+	calls int
+}
+
+func (c *countRefs) CountReferences(context.Context, string, string, *string) (int64, error) {
+	c.calls++
+	return c.n, c.err
+}
+
+func TestUnreferenced(t *testing.T) {
+	version := "v1"
+	versioned := metadata.Object{Bucket: "b", Key: "k", VersionID: &version}
+	if refs := (&countRefs{n: 3}); !unreferenced(context.Background(), refs, versioned) || refs.calls != 0 {
+		t.Fatal("a versioned write is always our own")
+	}
+	plain := metadata.Object{Bucket: "b", Key: "k"}
+	cases := []struct {
+		name string
+		refs *countRefs
+		want bool
+	}{
+		{"no rows", &countRefs{}, true},
+		{"referenced", &countRefs{n: 1}, false},
+		{"lookup failed", &countRefs{err: errors.New("timeout")}, false},
+	}
+	for _, c := range cases {
+		if got := unreferenced(context.Background(), c.refs, plain); got != c.want {
+			t.Fatalf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (s *Server) deleteObject(c *gin.Context) {
+	s.setStatus(c, metadata.StatusActive, metadata.StatusDeleted, "object_deleted")
+}
+
+func (s *Server) restoreObject(c *gin.Context) {
+	s.setStatus(c, metadata.StatusDeleted, metadata.StatusActive, "object_restored")
+}
+
+func (s *Server) setStatus(c *gin.Context, from, to, event string) {
+	virtualPath := c.Query("path")
+	if virtualPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path required"})
+		return
+	}
+	ctx := c.Request.Context()
+	days, err := s.repo.SetStatus(ctx, virtualPath, from, to)
+	if err != nil {
+		if errors.Is(err, metadata.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "status update failed"})
+		return
+	}
+	if err := s.resolver.Invalidate(ctx, virtualPath, days); err != nil {
+		s.log.Warn("invalidate resolver cache", zap.String("path", virtualPath), zap.Error(err))
+	}
+	s.redis.Publish(ctx, event, virtualPath)
+	c.JSON(http.StatusOK, gin.H{"path": virtualPath, "status": to, "rows": len(days)})
+}
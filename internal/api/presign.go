@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/example/fuses3redispostgres/internal/s3io"
+	"github.com/gin-gonic/gin"
+)
+
+type presignRequest struct {
+	Path       string `json:"path"`
+	Filename   string `json:"filename"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+}
+
+func (s *Server) presign(c *gin.Context) {
+	var req presignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	virtualPath := req.Path
+	if virtualPath == "" {
+		if req.Filename == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path or filename required"})
+			return
+		}
+		virtualPath = metadata.JoinVirtualPath("/files", req.Filename)
+	}
+	ttl, err := presignTTL(time.Duration(req.TTLSeconds)*time.Second, s.cfg.PresignDefaultTTL, s.maxPresignTTL(c.GetHeader("X-API-Key")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	obj, err := s.resolver.Resolve(c.Request.Context(), virtualPath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	out, err := s.store.Storage(obj.Bucket).PresignGet(c.Request.Context(), obj.Bucket, obj.Key, ttl)
+	if errors.Is(err, s3io.ErrPresignUnsupported) {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "presign failed"})
+		return
+	}
+	resp := gin.H{"path": obj.VirtualPath, "url": out.URL, "method": out.Method, "expires_at": time.Now().Add(ttl).UTC(), "size": obj.LogicalSize(), "etag": obj.ETag}
+	if obj.Codec != "" {
+		// The URL serves the stored bytes, which the client has to decode.
+		resp["codec"], resp["stored_size"] = obj.Codec, obj.Size
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// maxPresignTTL is the longest TTL apiKey may ask for: its entry in
+// PRESIGN_KEY_MAX_TTLS, clamped by PRESIGN_MAX_TTL.
+func (s *Server) maxPresignTTL(apiKey string) time.Duration {
+	max := s.cfg.PresignMaxTTL
+	if k, ok := s.cfg.PresignKeyMaxTTLs[apiKey]; ok && k < max {
+		max = k
+	}
+	return max
+}
+
+func presignTTL(requested, def, max time.Duration) (time.Duration, error) {
+	if requested < 0 {
+		return 0, fmt.Errorf("ttl_seconds must be positive")
+	}
+	if requested == 0 {
+		requested = def
+		if requested > max {
+			requested = max
+		}
+	}
+	if requested > max {
+		return 0, fmt.Errorf("ttl_seconds exceeds maximum of %d", int64(max/time.Second))
+	}
+	return requested, nil
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/config"
+)
+
+func TestPresignTTL(t *testing.T) {
+	if got, err := presignTTL(0, 15*time.Minute, time.Hour); err != nil || got != 15*time.Minute {
+		t.Fatalf("default ttl: %v %v", got, err)
+	}
+	if got, err := presignTTL(0, 15*time.Minute, 5*time.Minute); err != nil || got != 5*time.Minute {
+		t.Fatalf("default ttl clamped to max: %v %v", got, err)
+	}
+	if _, err := presignTTL(2*time.Hour, 15*time.Minute, time.Hour); err == nil {
+		t.Fatal("expected error above max")
+	}
+}
+
+func TestMaxPresignTTLPerKey(t *testing.T) {
+	s := &Server{cfg: config.App{PresignMaxTTL: time.Hour, PresignKeyMaxTTLs: map[string]time.Duration{"short": 10 * time.Minute, "long": 48 * time.Hour}}}
+	for key, want := range map[string]time.Duration{"short": 10 * time.Minute, "long": time.Hour, "other": time.Hour} {
+		if got := s.maxPresignTTL(key); got != want {
+			t.Fatalf("%s: got %s, want %s", key, got, want)
+		}
+	}
+	if _, err := presignTTL(20*time.Minute, 15*time.Minute, s.maxPresignTTL("short")); err == nil {
+		t.Fatal("expected error above the key's max")
+	}
+}
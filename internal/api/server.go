@@ -2,23 +2,24 @@ package api
 
 import (
 	"context"
-	"crypto/md5"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"path"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/example/fuses3redispostgres/internal/auth"
 	"github.com/example/fuses3redispostgres/internal/config"
 	"github.com/example/fuses3redispostgres/internal/idempotency"
 	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/example/fuses3redispostgres/internal/placement"
+	"github.com/example/fuses3redispostgres/internal/s3io"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
@@ -28,16 +29,18 @@ import (
 var dateRE = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
 
 type Server struct {
-	cfg      config.App
-	log      *zap.Logger
-	repo     *metadata.Repository
-	resolver *metadata.Resolver
-	uploader *manager.Uploader
-	redis    *redis.Client
+	cfg       config.App
+	log       *zap.Logger
+	repo      *metadata.Repository
+	resolver  *metadata.Resolver
+	store     *s3io.Backends
+	reader    *s3io.Reader
+	redis     *redis.Client
+	placement placement.Placement
 }
 
-func New(cfg config.App, log *zap.Logger, repo *metadata.Repository, resolver *metadata.Resolver, s3c *s3.Client, rdb *redis.Client) *Server {
-	return &Server{cfg: cfg, log: log, repo: repo, resolver: resolver, uploader: manager.NewUploader(s3c), redis: rdb}
+func New(cfg config.App, log *zap.Logger, repo *metadata.Repository, resolver *metadata.Resolver, backends *s3io.Backends, reader *s3io.Reader, rdb *redis.Client, place placement.Placement) *Server {
+	return &Server{cfg: cfg, log: log, repo: repo, resolver: resolver, store: backends, reader: reader, redis: rdb, placement: place}
 }
 
 func (s *Server) Router() *gin.Engine {
@@ -47,6 +50,17 @@ func (s *Server) Router() *gin.Engine {
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	r.POST("/v1/upload", s.upload)
 	r.GET("/v1/resolve", s.resolve)
+	r.GET("/v1/list", s.list)
+	r.GET("/v1/files", s.download)
+	r.POST("/v1/presign", s.presign)
+	r.GET("/v1/versions", s.versions)
+	r.DELETE("/v1/objects", s.deleteObject)
+	r.POST("/v1/objects/restore", s.restoreObject)
+	r.POST("/v1/uploads", s.createUpload)
+	r.GET("/v1/uploads/:id", s.uploadStatus)
+	r.PUT("/v1/uploads/:id/parts/:n", s.uploadPart)
+	r.POST("/v1/uploads/:id/complete", s.completeUpload)
+	r.DELETE("/v1/uploads/:id", s.abortUpload)
 	return r
 }
 
@@ -64,42 +78,193 @@ func (s *Server) resolve(c *gin.Context) {
 	c.JSON(http.StatusOK, obj)
 }
 
-func (s *Server) upload(c *gin.Context) {
+func (s *Server) download(c *gin.Context) {
+	virtualPath := c.Query("path")
+	if virtualPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path required"})
+		return
+	}
+	var obj metadata.Object
+	var err error
+	if raw := c.Query("version"); raw != "" {
+		n, perr := strconv.Atoi(raw)
+		if perr != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+		obj, err = s.resolver.ResolveVersion(c.Request.Context(), virtualPath, n)
+	} else {
+		obj, err = s.resolver.Resolve(c.Request.Context(), virtualPath)
+	}
+	if err != nil {
+		if errors.Is(err, metadata.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "resolve failed"})
+		}
+		return
+	}
+	var body io.ReadSeekCloser = s3io.NewObjectReader(c.Request.Context(), s.reader, obj.Bucket, obj.Key, obj.Version(), obj.ETag, obj.Size)
+	if obj.Codec != "" {
+		body, err = s3io.NewDecodedReader(c.Request.Context(), s.reader, obj.Bucket, obj.Key, obj.Version(), obj.ETag, obj.Size, obj.Codec)
+		if err != nil {
+			s.log.Warn("open compressed object", zap.String("path", obj.VirtualPath), zap.Error(err))
+			c.JSON(http.StatusBadGateway, gin.H{"error": "read failed"})
+			return
+		}
+	}
+	defer body.Close()
+	ctype := mime.TypeByExtension(path.Ext(obj.Filename))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	c.Header("Content-Type", ctype)
+	if obj.ETag != "" {
+		c.Header("ETag", quoteETag(obj.ETag))
+	}
+	http.ServeContent(c.Writer, c.Request, obj.Filename, obj.LastModified, body)
+}
+
+func (s *Server) versions(c *gin.Context) {
+	virtualPath := c.Query("path")
+	if virtualPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path required"})
+		return
+	}
+	versions, err := s.repo.ListVersions(c.Request.Context(), virtualPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list versions failed"})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"path": versions[0].VirtualPath, "versions": versions})
+}
+
+func (s *Server) list(c *gin.Context) {
+	dir := c.DefaultQuery("path", "/")
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil || limit <= 0 || limit > 10000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 10000"})
+		return
+	}
+	if _, err := s.repo.StatDir(c.Request.Context(), dir); err != nil {
+		if errors.Is(err, metadata.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "stat dir failed"})
+		return
+	}
+	children, err := s.repo.ListChildren(c.Request.Context(), dir, c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list failed"})
+		return
+	}
+	next := ""
+	if len(children) == limit {
+		next = children[len(children)-1].Name
+	}
+	c.JSON(http.StatusOK, gin.H{"path": dir, "entries": children, "next_cursor": next})
+}
+
+// uploadTarget reads the date and virtual path of an upload from the query.
+func uploadTarget(c *gin.Context) (string, time.Time, bool) {
 	dateRaw, filename := c.Query("date"), c.Query("filename")
 	virtualPath := c.Query("path")
 	if !dateRE.MatchString(dateRaw) || (filename == "" && virtualPath == "") {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date and path/filename"})
-		return
+		return "", time.Time{}, false
 	}
 	dateVal, _ := time.Parse("2006-01-02", dateRaw)
 	if virtualPath == "" {
 		virtualPath = metadata.JoinVirtualPath("/files", filename)
 	}
-	filename = path.Base(virtualPath)
-	bucket, key := decideBucketKey(dateVal, filename)
+	return virtualPath, dateVal, true
+}
+
+func (s *Server) upload(c *gin.Context) {
+	virtualPath, dateVal, ok := uploadTarget(c)
+	if !ok {
+		return
+	}
+	filename := path.Base(virtualPath)
+	bucket, key, ok := s.placeUpload(c, virtualPath, dateVal)
+	if !ok {
+		return
+	}
+	want, err := parseDigests(c.Request.Header)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	codec, err := s.compression(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	file, closeFn, err := extractReader(c, filename)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	defer closeFn()
-	md5h := md5.New()
-	sha := sha256.New()
-	tee := io.TeeReader(file, io.MultiWriter(md5h, sha))
-
-	cr := &countingReader{r: tee}
-	upOut, err := s.uploader.Upload(context.Background(), &s3.PutObjectInput{Bucket: &bucket, Key: &key, Body: cr})
+	body := newVerifyingReader(file, want)
+	var stored io.Reader = body
+	var packed *compressingReader
+	if codec != "" {
+		packed = newCompressingReader(body)
+		defer packed.Close()
+		stored = packed
+	}
+	upOut, err := s.store.Storage(bucket).Put(context.Background(), bucket, key, stored)
+	var mismatch *digestMismatch
+	if errors.As(err, &mismatch) {
+		checksumMismatch(c, mismatch)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "s3 upload failed"})
 		return
 	}
-	obj := metadata.Object{VirtualPath: virtualPath, Filename: filename, Bucket: bucket, Key: key, Size: cr.n, ETag: ptrStr(upOut.ETag), LastModified: time.Now().UTC(), ChecksumMD5: ptr(hex.EncodeToString(md5h.Sum(nil))), ChecksumSHA: ptr(hex.EncodeToString(sha.Sum(nil)))}
-	if err := s.repo.UpsertObject(c.Request.Context(), obj, dateVal, "active"); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "metadata upsert failed"})
+	obj := metadata.Object{VirtualPath: virtualPath, Filename: filename, Bucket: bucket, Key: key, Size: body.n, ETag: upOut.ETag, LastModified: time.Now().UTC(), VersionID: upOut.VersionID, ChecksumMD5: ptr(body.md5Hex()), ChecksumSHA: ptr(body.sha256Hex()), Placement: s.placement.VersionFor(codec)}
+	if packed != nil {
+		obj.Size, obj.Codec, obj.OriginalSize = packed.n, codec, body.n
+	}
+	if mismatch := body.check(); mismatch != nil {
+		s.deleteStored(context.Background(), obj)
+		checksumMismatch(c, mismatch)
 		return
 	}
-	s.redis.Publish(c.Request.Context(), "object_ingested", fmt.Sprintf("%s|%s|%s", virtualPath, bucket, key))
-	c.JSON(http.StatusOK, gin.H{"path": virtualPath, "bucket": bucket, "key": key, "size": obj.Size, "etag": obj.ETag, "checksums": gin.H{"md5": obj.ChecksumMD5, "sha256": obj.ChecksumSHA}})
+	s.commitUpload(c, obj, dateVal, s.dedupRequested(c))
+}
+
+// commitUpload records an object already in storage and writes the upload
+// response. When the row cannot be written the stored object is deleted.
+func (s *Server) commitUpload(c *gin.Context, obj metadata.Object, dateVal time.Time, dedup bool) {
+	stored := obj
+	deduplicated := false
+	if dedup {
+		deduplicated = s.dedup(c.Request.Context(), &obj)
+	}
+	if err := s.repo.InsertObject(c.Request.Context(), obj, dateVal, metadata.StatusActive); err != nil {
+		if !deduplicated {
+			s.deleteStored(c.Request.Context(), stored)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "metadata insert failed"})
+		return
+	}
+	if err := s.resolver.Invalidate(c.Request.Context(), obj.VirtualPath, []time.Time{dateVal}); err != nil {
+		s.log.Warn("invalidate resolver cache", zap.String("path", obj.VirtualPath), zap.Error(err))
+	}
+	s.redis.Publish(c.Request.Context(), "object_ingested", fmt.Sprintf("%s|%s|%s", obj.VirtualPath, obj.Bucket, obj.Key))
+	resp := gin.H{"path": obj.VirtualPath, "bucket": obj.Bucket, "key": obj.Key, "size": obj.LogicalSize(), "etag": obj.ETag, "version_id": obj.VersionID, "deduplicated": deduplicated, "checksums": gin.H{"md5": obj.ChecksumMD5, "sha256": obj.ChecksumSHA}}
+	if obj.Codec != "" {
+		resp["codec"], resp["stored_size"] = obj.Codec, obj.Size
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 func extractReader(c *gin.Context, fallbackName string) (io.Reader, func(), error) {
@@ -113,12 +278,27 @@ func extractReader(c *gin.Context, fallbackName string) (io.Reader, func(), erro
 	return f, func() { _ = f.Close() }, nil
 }
 
-func decideBucketKey(date time.Time, filename string) (string, string) {
-	bucket := fmt.Sprintf("data-%d", date.Year())
-	h := sha256.Sum256([]byte(filename))
-	prefix := hex.EncodeToString(h[:])[:4]
-	key := path.Join(date.Format("2006/01/02"), prefix, filename)
-	return bucket, key
+// placeUpload asks the placement policy for the bucket and key of an upload.
+// The tenant comes from the X-Tenant header or the tenant query parameter.
+// Every upload gets a fresh id for the {upload} token, so its key is unique.
+func (s *Server) placeUpload(c *gin.Context, virtualPath string, dateVal time.Time) (string, string, bool) {
+	tenant := c.GetHeader("X-Tenant")
+	if tenant == "" {
+		tenant = c.Query("tenant")
+	}
+	bucket, key, err := s.placement.Place(placement.Request{Date: dateVal, VirtualPath: virtualPath, Filename: path.Base(virtualPath), Tenant: tenant, Upload: newSessionID()})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", "", false
+	}
+	return bucket, key, true
+}
+
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
 }
 
 func ptr(s string) *string { return &s }
@@ -130,14 +310,3 @@ func ptrStr(s *string) string {
 }
 
 func closeMultipart(f multipart.File) { _ = f.Close() }
-
-type countingReader struct {
-	r io.Reader
-	n int64
-}
-
-func (c *countingReader) Read(p []byte) (int, error) {
-	n, err := c.r.Read(p)
-	c.n += int64(n)
-	return n, err
-}
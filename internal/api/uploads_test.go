@@ -0,0 +1,46 @@
+package api
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMissingParts(t *testing.T) {
+	parts := []uploadPart{{Number: 1}, {Number: 2}, {Number: 5}}
+	if got := missingParts(parts); !reflect.DeepEqual(got, []int{3, 4}) {
+		t.Fatalf("missing: %v", got)
+	}
+	if got := missingParts(parts[:2]); got != nil {
+		t.Fatalf("contiguous parts reported missing: %v", got)
+	}
+	if got := missingParts([]uploadPart{{Number: 2}}); !reflect.DeepEqual(got, []int{1}) {
+		t.Fatalf("missing first part: %v", got)
+	}
+}
+
+func TestFoldPart(t *testing.T) {
+	sess := uploadSession{SHAState: marshalHash(sha256.New()), MD5State: marshalHash(md5.New())}
+	for n, body := range []string{"hello ", "world"} {
+		if changed, err := foldPart(&sess, n+1, strings.NewReader(body)); err != nil || !changed {
+			t.Fatalf("part %d: changed=%v %v", n+1, changed, err)
+		}
+	}
+	sha := sha256.New()
+	if err := unmarshalHash(sha, sess.SHAState); err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256([]byte("hello world"))
+	if sess.HashedThrough != 2 || hex.EncodeToString(sha.Sum(nil)) != hex.EncodeToString(want[:]) {
+		t.Fatalf("running digest after %d parts is wrong", sess.HashedThrough)
+	}
+	if changed, _ := foldPart(&sess, 4, strings.NewReader("x")); changed {
+		t.Fatal("a part ahead of sequence should not change the session")
+	}
+	if changed, _ := foldPart(&sess, 1, strings.NewReader("x")); !changed || sess.HashedThrough != -1 {
+		t.Fatal("a re-sent part should stop the running digests")
+	}
+}
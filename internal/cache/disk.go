@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const blockExt = ".blk"
+
+type BlockKey struct {
+	Bucket    string
+	Key       string
+	VersionID string
+	ETag      string
+	Index     int64
+}
+
+type diskEntry struct {
+	path string
+	oid  string
+	size int64
+}
+
+type diskObject struct {
+	tag    string
+	blocks map[string]*list.Element
+}
+
+// Disk keeps blocks at <dir>/<oid[:2]>/<oid>/<etag>-<index>.blk so the index
+// can be rebuilt from the directory alone after a remount.
+type Disk struct {
+	mu    sync.Mutex
+	dir   string
+	max   int64
+	size  int64
+	order *list.List
+	objs  map[string]*diskObject
+}
+
+func NewDisk(dir string, maxBytes int64) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	d := &Disk{dir: dir, max: maxBytes, order: list.New(), objs: map[string]*diskObject{}}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Disk) Get(k BlockKey) ([]byte, bool) {
+	oid, tag := objectID(k.Bucket, k.Key, k.VersionID), etagID(k.ETag)
+	p := d.blockPath(oid, tag, k.Index)
+	d.mu.Lock()
+	var el *list.Element
+	o, ok := d.objs[oid]
+	if ok && o.tag != tag {
+		d.dropLocked(o)
+		ok = false
+	}
+	if ok {
+		el, ok = o.blocks[p]
+	}
+	if ok {
+		d.order.MoveToFront(el)
+	}
+	d.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		// A Put or eviction may have replaced or removed the entry while
+		// the file was read; only drop it if it is still the one we saw.
+		d.mu.Lock()
+		if cur, ok := d.objs[oid]; ok && cur == o && o.blocks[p] == el {
+			d.removeLocked(el)
+		}
+		d.mu.Unlock()
+		return nil, false
+	}
+	return b, true
+}
+
+func (d *Disk) Put(k BlockKey, data []byte) error {
+	if int64(len(data)) > d.max {
+		return nil
+	}
+	oid, tag := objectID(k.Bucket, k.Key, k.VersionID), etagID(k.ETag)
+	p := d.blockPath(oid, tag, k.Index)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("create block dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), "*.tmp")
+	if err != nil {
+		return fmt.Errorf("create block file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write block: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("close block: %w", err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if o, ok := d.objs[oid]; ok {
+		if o.tag != tag {
+			d.dropLocked(o)
+		} else if el, ok := o.blocks[p]; ok {
+			d.removeLocked(el)
+		}
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("commit block: %w", err)
+	}
+	d.addLocked(tag, diskEntry{path: p, oid: oid, size: int64(len(data))})
+	d.evictLocked()
+	return nil
+}
+
+func (d *Disk) Size() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.size
+}
+
+func (d *Disk) load() error {
+	type found struct {
+		diskEntry
+		tag string
+		mod time.Time
+	}
+	var all []found
+	err := filepath.WalkDir(d.dir, func(p string, de fs.DirEntry, err error) error {
+		if err != nil || de.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(p, ".tmp") {
+			return os.Remove(p)
+		}
+		tag, _, ok := parseBlockName(de.Name())
+		if !ok {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return nil
+		}
+		all = append(all, found{diskEntry: diskEntry{path: p, oid: filepath.Base(filepath.Dir(p)), size: info.Size()}, tag: tag, mod: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("scan cache dir: %w", err)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].mod.Before(all[j].mod) })
+	latest := map[string]string{}
+	for _, f := range all {
+		latest[f.oid] = f.tag
+	}
+	for _, f := range all {
+		if latest[f.oid] != f.tag {
+			os.Remove(f.path)
+			continue
+		}
+		d.addLocked(f.tag, f.diskEntry)
+	}
+	d.evictLocked()
+	return nil
+}
+
+func (d *Disk) addLocked(tag string, e diskEntry) {
+	o, ok := d.objs[e.oid]
+	if !ok {
+		o = &diskObject{tag: tag, blocks: map[string]*list.Element{}}
+		d.objs[e.oid] = o
+	}
+	o.blocks[e.path] = d.order.PushFront(e)
+	d.size += e.size
+}
+
+func (d *Disk) removeLocked(el *list.Element) {
+	e := el.Value.(diskEntry)
+	d.order.Remove(el)
+	d.size -= e.size
+	if o, ok := d.objs[e.oid]; ok {
+		delete(o.blocks, e.path)
+		if len(o.blocks) == 0 {
+			delete(d.objs, e.oid)
+		}
+	}
+	os.Remove(e.path)
+}
+
+// dropLocked removes every block of an object whose ETag changed so stale
+// content is never served.
+func (d *Disk) dropLocked(o *diskObject) {
+	for _, el := range o.blocks {
+		d.removeLocked(el)
+	}
+}
+
+func (d *Disk) evictLocked() {
+	for d.size > d.max {
+		last := d.order.Back()
+		if last == nil {
+			return
+		}
+		d.removeLocked(last)
+	}
+}
+
+func (d *Disk) blockPath(oid, tag string, idx int64) string {
+	return filepath.Join(d.dir, oid[:2], oid, tag+"-"+strconv.FormatInt(idx, 10)+blockExt)
+}
+
+func parseBlockName(name string) (tag string, idx int64, ok bool) {
+	if !strings.HasSuffix(name, blockExt) {
+		return "", 0, false
+	}
+	tag, raw, found := strings.Cut(strings.TrimSuffix(name, blockExt), "-")
+	if !found {
+		return "", 0, false
+	}
+	idx, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return tag, idx, true
+}
+
+func objectID(bucket, key, versionID string) string {
+	id := bucket + "\x00" + key
+	if versionID != "" {
+		id += "\x00" + versionID
+	}
+	s := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(s[:])
+}
+
+func etagID(etag string) string {
+	s := sha256.Sum256([]byte(strings.Trim(etag, `"`)))
+	return hex.EncodeToString(s[:8])
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDiskEvictBySize(t *testing.T) {
+	d, err := NewDisk(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := BlockKey{Bucket: "b", Key: "k", ETag: "e"}
+	for i := int64(0); i < 3; i++ {
+		k.Index = i
+		if err := d.Put(k, []byte("abcd")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d.Size() != 8 {
+		t.Fatalf("unexpected size %d", d.Size())
+	}
+	if _, ok := d.Get(BlockKey{Bucket: "b", Key: "k", ETag: "e", Index: 0}); ok {
+		t.Fatal("expected block 0 evicted")
+	}
+}
+
+func TestDiskReloadAndStaleETag(t *testing.T) {
+	dir := t.TempDir()
+	d, _ := NewDisk(dir, 1<<20)
+	k := BlockKey{Bucket: "b", Key: "k", ETag: "v1", Index: 2}
+	if err := d.Put(k, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDisk(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := d.Get(k); !ok || !bytes.Equal(got, []byte("hello")) {
+		t.Fatal("expected block to survive reload")
+	}
+	k.ETag = "v2"
+	if _, ok := d.Get(k); ok {
+		t.Fatal("expected miss for new etag")
+	}
+	k.ETag = "v1"
+	if _, ok := d.Get(k); ok {
+		t.Fatal("expected stale block dropped")
+	}
+	if d.Size() != 0 {
+		t.Fatalf("unexpected size %d", d.Size())
+	}
+}
@@ -50,3 +50,12 @@ func (l *LRU[K, V]) Set(k K, v V) {
 		}
 	}
 }
+
+func (l *LRU[K, V]) Delete(k K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[k]; ok {
+		l.order.Remove(el)
+		delete(l.items, k)
+	}
+}
@@ -14,3 +14,17 @@ func TestLRUEvict(t *testing.T) {
 		t.Fatal("expected c present")
 	}
 }
+
+func TestLRUDelete(t *testing.T) {
+	l := NewLRU[string, int](2)
+	l.Set("a", 1)
+	l.Delete("a")
+	if _, ok := l.Get("a"); ok {
+		t.Fatal("expected a deleted")
+	}
+	l.Set("b", 2)
+	l.Set("c", 3)
+	if _, ok := l.Get("b"); !ok {
+		t.Fatal("expected b present")
+	}
+}
@@ -8,28 +8,117 @@ import (
 	"github.com/spf13/viper"
 )
 
+// MaxPresignTTL is the longest expiry S3 accepts for a SigV4 presigned URL.
+const MaxPresignTTL = 7 * 24 * time.Hour
+
 type App struct {
-	ServiceName      string
-	LogLevel         string
-	HTTPAddr         string
-	MetricsAddr      string
-	PostgresDSN      string
-	RedisAddr        string
-	RedisPassword    string
-	RedisDB          int
-	S3Region         string
-	S3Endpoint       string
-	CacheDir         string
-	CacheSizeBytes   int64
-	BlockSizeBytes   int64
-	PrefetchSizeByte int64
-	GlobalS3Limit    int64
-	PerBucketS3Limit int64
-	Timeout          time.Duration
-	APIKey           string
-	RateLimitRPS     int
-	FuseMountPoint   string
-	ScanDirs         []string
+	ServiceName       string
+	LogLevel          string
+	HTTPAddr          string
+	MetricsAddr       string
+	PostgresDSN       string
+	RedisAddr         string
+	RedisPassword     string
+	RedisDB           int
+	S3Region          string
+	S3Endpoint        string
+	S3PathStyle       bool
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3SessionToken    string
+	S3CABundle        string
+	S3MaxAttempts     int
+	S3MaxBackoff      time.Duration
+	StorageType       string
+	StorageRoot       string
+	S3Backends        []S3Backend
+	S3BucketRoutes    []BucketRoute
+	CacheDir          string
+	CacheSizeBytes    int64
+	BlockSizeBytes    int64
+	PrefetchSizeByte  int64
+	MemCacheBytes     int64
+	BufferMemoryBytes int64
+	MemCacheTTL       time.Duration
+	ReadAttempts      int
+	AttemptTimeout    time.Duration
+	ReadBackoff       time.Duration
+	ReadMaxBackoff    time.Duration
+	ReadHedge         bool
+	GlobalS3Limit     int64
+	PerBucketS3Limit  int64
+	PerBucketS3Min    int64
+	PerBucketS3Max    int64
+	Timeout           time.Duration
+	APIKey            string
+	RateLimitRPS      int
+	FuseMountPoint    string
+	ScanDirs          []string
+
+	ReaddirPageSize   int
+	ReaddirMaxEntries int
+	ReaddirCacheTTL   time.Duration
+	FuseKeepCache     bool
+	FuseDecompress    bool
+	DecompressSpacing int64
+	DecompressTimeout time.Duration
+
+	PresignDefaultTTL time.Duration
+	PresignMaxTTL     time.Duration
+	PresignKeyMaxTTLs map[string]time.Duration
+
+	PurgeGracePeriod time.Duration
+	PurgeInterval    time.Duration
+
+	DedupEnabled bool
+
+	UploadSessionTTL   time.Duration
+	UploadPartSize     int64
+	MultipartThreshold int64
+
+	VerifyInterval time.Duration
+	VerifyMaxAge   time.Duration
+
+	PlacementMode       string
+	PlacementBucket     string
+	PlacementKey        string
+	PlacementShardChars int
+	PlacementShardDepth int
+	PlacementVersion    string
+	PlacementCompress   string
+}
+
+// S3Backend is one named store: an S3 endpoint and credential set, or with
+// Type "local" a directory at Root.
+type S3Backend struct {
+	Name            string
+	Type            string
+	Root            string
+	Region          string
+	Endpoint        string
+	PathStyle       bool
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	CABundle        string
+	MaxAttempts     int
+	MaxBackoff      time.Duration
+}
+
+// BucketRoute sends buckets matching Pattern (path.Match syntax) to the
+// named backend.
+type BucketRoute struct {
+	Pattern string
+	Backend string
+}
+
+// DefaultS3Backend is the backend described by the top-level S3_* settings.
+func (a App) DefaultS3Backend() S3Backend {
+	return S3Backend{
+		Name: "default", Type: a.StorageType, Root: a.StorageRoot, Region: a.S3Region, Endpoint: a.S3Endpoint, PathStyle: a.S3PathStyle,
+		AccessKeyID: a.S3AccessKeyID, SecretAccessKey: a.S3SecretAccessKey, SessionToken: a.S3SessionToken,
+		CABundle: a.S3CABundle, MaxAttempts: a.S3MaxAttempts, MaxBackoff: a.S3MaxBackoff,
+	}
 }
 
 func Load(path string) (App, error) {
@@ -50,39 +139,223 @@ func Load(path string) (App, error) {
 	v.SetDefault("CACHE_SIZE_BYTES", int64(10*1024*1024*1024))
 	v.SetDefault("BLOCK_SIZE_BYTES", int64(8*1024*1024))
 	v.SetDefault("PREFETCH_SIZE_BYTES", int64(32*1024*1024))
+	v.SetDefault("MEM_CACHE_BYTES", int64(256*1024*1024))
+	v.SetDefault("MEM_CACHE_TTL", "5s")
+	v.SetDefault("BUFFER_MEMORY_BYTES", int64(1024*1024*1024))
+	v.SetDefault("READ_ATTEMPTS", 3)
+	v.SetDefault("READ_ATTEMPT_TIMEOUT", "0s")
+	v.SetDefault("READ_BACKOFF", "100ms")
+	v.SetDefault("READ_MAX_BACKOFF", "2s")
+	v.SetDefault("READ_HEDGE", false)
+	v.SetDefault("STORAGE_TYPE", "s3")
+	v.SetDefault("S3_MAX_ATTEMPTS", 3)
+	v.SetDefault("S3_MAX_BACKOFF", "20s")
 	v.SetDefault("GLOBAL_S3_LIMIT", int64(200))
 	v.SetDefault("PER_BUCKET_S3_LIMIT", int64(20))
+	v.SetDefault("PER_BUCKET_S3_MIN", int64(2))
+	v.SetDefault("PER_BUCKET_S3_MAX", int64(100))
 	v.SetDefault("TIMEOUT", "30s")
 	v.SetDefault("RATE_LIMIT_RPS", 50)
 	v.SetDefault("FUSE_MOUNT_POINT", "/mnt/virtualfs")
+	v.SetDefault("READDIR_PAGE_SIZE", 1000)
+	v.SetDefault("READDIR_MAX_ENTRIES", 100000)
+	v.SetDefault("READDIR_CACHE_TTL", "30s")
+	v.SetDefault("PRESIGN_DEFAULT_TTL", "15m")
+	v.SetDefault("PRESIGN_MAX_TTL", "12h")
+	v.SetDefault("PURGE_GRACE_PERIOD", "168h")
+	v.SetDefault("PURGE_INTERVAL", "1h")
+	v.SetDefault("DEDUP_ENABLED", false)
+	v.SetDefault("UPLOAD_SESSION_TTL", "168h")
+	v.SetDefault("UPLOAD_PART_SIZE", int64(64*1024*1024))
+	v.SetDefault("MULTIPART_THRESHOLD", int64(256*1024*1024))
+	v.SetDefault("VERIFY_INTERVAL", "1h")
+	v.SetDefault("VERIFY_MAX_AGE", "720h")
+	v.SetDefault("PLACEMENT_MODE", "template")
+	v.SetDefault("FUSE_DECOMPRESS", false)
+	v.SetDefault("DECOMPRESS_CHECKPOINT_BYTES", int64(16*1024*1024))
+	v.SetDefault("DECOMPRESS_INDEX_TIMEOUT", "10m")
 
 	timeout, err := time.ParseDuration(v.GetString("TIMEOUT"))
 	if err != nil {
 		return App{}, fmt.Errorf("parse TIMEOUT: %w", err)
 	}
-	return App{
-		ServiceName:      v.GetString("SERVICE_NAME"),
-		LogLevel:         v.GetString("LOG_LEVEL"),
-		HTTPAddr:         v.GetString("HTTP_ADDR"),
-		MetricsAddr:      v.GetString("METRICS_ADDR"),
-		PostgresDSN:      v.GetString("POSTGRES_DSN"),
-		RedisAddr:        v.GetString("REDIS_ADDR"),
-		RedisPassword:    v.GetString("REDIS_PASSWORD"),
-		RedisDB:          v.GetInt("REDIS_DB"),
-		S3Region:         v.GetString("S3_REGION"),
-		S3Endpoint:       v.GetString("S3_ENDPOINT"),
-		CacheDir:         v.GetString("CACHE_DIR"),
-		CacheSizeBytes:   v.GetInt64("CACHE_SIZE_BYTES"),
-		BlockSizeBytes:   v.GetInt64("BLOCK_SIZE_BYTES"),
-		PrefetchSizeByte: v.GetInt64("PREFETCH_SIZE_BYTES"),
-		GlobalS3Limit:    v.GetInt64("GLOBAL_S3_LIMIT"),
-		PerBucketS3Limit: v.GetInt64("PER_BUCKET_S3_LIMIT"),
-		Timeout:          timeout,
-		APIKey:           v.GetString("API_KEY"),
-		RateLimitRPS:     v.GetInt("RATE_LIMIT_RPS"),
-		FuseMountPoint:   v.GetString("FUSE_MOUNT_POINT"),
-		ScanDirs:         splitCSV(v.GetString("SCAN_DIRS")),
-	}, nil
+	s3Backoff, err := time.ParseDuration(v.GetString("S3_MAX_BACKOFF"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse S3_MAX_BACKOFF: %w", err)
+	}
+	memCacheTTL, err := time.ParseDuration(v.GetString("MEM_CACHE_TTL"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse MEM_CACHE_TTL: %w", err)
+	}
+	readAttemptTimeout, err := time.ParseDuration(v.GetString("READ_ATTEMPT_TIMEOUT"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse READ_ATTEMPT_TIMEOUT: %w", err)
+	}
+	readBackoff, err := time.ParseDuration(v.GetString("READ_BACKOFF"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse READ_BACKOFF: %w", err)
+	}
+	readMaxBackoff, err := time.ParseDuration(v.GetString("READ_MAX_BACKOFF"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse READ_MAX_BACKOFF: %w", err)
+	}
+	readdirTTL, err := time.ParseDuration(v.GetString("READDIR_CACHE_TTL"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse READDIR_CACHE_TTL: %w", err)
+	}
+	decompTimeout, err := time.ParseDuration(v.GetString("DECOMPRESS_INDEX_TIMEOUT"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse DECOMPRESS_INDEX_TIMEOUT: %w", err)
+	}
+	presignDefault, err := time.ParseDuration(v.GetString("PRESIGN_DEFAULT_TTL"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse PRESIGN_DEFAULT_TTL: %w", err)
+	}
+	presignMax, err := time.ParseDuration(v.GetString("PRESIGN_MAX_TTL"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse PRESIGN_MAX_TTL: %w", err)
+	}
+	if presignMax > MaxPresignTTL {
+		return App{}, fmt.Errorf("PRESIGN_MAX_TTL %s exceeds the S3 limit of %s", presignMax, MaxPresignTTL)
+	}
+	purgeGrace, err := time.ParseDuration(v.GetString("PURGE_GRACE_PERIOD"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse PURGE_GRACE_PERIOD: %w", err)
+	}
+	purgeInterval, err := time.ParseDuration(v.GetString("PURGE_INTERVAL"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse PURGE_INTERVAL: %w", err)
+	}
+	sessionTTL, err := time.ParseDuration(v.GetString("UPLOAD_SESSION_TTL"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse UPLOAD_SESSION_TTL: %w", err)
+	}
+	verifyInterval, err := time.ParseDuration(v.GetString("VERIFY_INTERVAL"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse VERIFY_INTERVAL: %w", err)
+	}
+	verifyMaxAge, err := time.ParseDuration(v.GetString("VERIFY_MAX_AGE"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse VERIFY_MAX_AGE: %w", err)
+	}
+	presignKeys, err := parseDurationMap(v.GetString("PRESIGN_KEY_MAX_TTLS"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse PRESIGN_KEY_MAX_TTLS: %w", err)
+	}
+	routes, err := parseRoutes(v.GetString("S3_BUCKET_ROUTES"))
+	if err != nil {
+		return App{}, fmt.Errorf("parse S3_BUCKET_ROUTES: %w", err)
+	}
+	app := App{
+		ServiceName:       v.GetString("SERVICE_NAME"),
+		LogLevel:          v.GetString("LOG_LEVEL"),
+		HTTPAddr:          v.GetString("HTTP_ADDR"),
+		MetricsAddr:       v.GetString("METRICS_ADDR"),
+		PostgresDSN:       v.GetString("POSTGRES_DSN"),
+		RedisAddr:         v.GetString("REDIS_ADDR"),
+		RedisPassword:     v.GetString("REDIS_PASSWORD"),
+		RedisDB:           v.GetInt("REDIS_DB"),
+		S3Region:          v.GetString("S3_REGION"),
+		S3Endpoint:        v.GetString("S3_ENDPOINT"),
+		StorageType:       v.GetString("STORAGE_TYPE"),
+		StorageRoot:       v.GetString("STORAGE_ROOT"),
+		S3PathStyle:       v.GetBool("S3_PATH_STYLE"),
+		S3AccessKeyID:     v.GetString("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey: v.GetString("S3_SECRET_ACCESS_KEY"),
+		S3SessionToken:    v.GetString("S3_SESSION_TOKEN"),
+		S3CABundle:        v.GetString("S3_CA_BUNDLE"),
+		S3MaxAttempts:     v.GetInt("S3_MAX_ATTEMPTS"),
+		S3MaxBackoff:      s3Backoff,
+		CacheDir:          v.GetString("CACHE_DIR"),
+		CacheSizeBytes:    v.GetInt64("CACHE_SIZE_BYTES"),
+		BlockSizeBytes:    v.GetInt64("BLOCK_SIZE_BYTES"),
+		PrefetchSizeByte:  v.GetInt64("PREFETCH_SIZE_BYTES"),
+		MemCacheBytes:     v.GetInt64("MEM_CACHE_BYTES"),
+		MemCacheTTL:       memCacheTTL,
+		BufferMemoryBytes: v.GetInt64("BUFFER_MEMORY_BYTES"),
+		ReadAttempts:      v.GetInt("READ_ATTEMPTS"),
+		AttemptTimeout:    readAttemptTimeout,
+		ReadBackoff:       readBackoff,
+		ReadMaxBackoff:    readMaxBackoff,
+		ReadHedge:         v.GetBool("READ_HEDGE"),
+		GlobalS3Limit:     v.GetInt64("GLOBAL_S3_LIMIT"),
+		PerBucketS3Limit:  v.GetInt64("PER_BUCKET_S3_LIMIT"),
+		PerBucketS3Min:    v.GetInt64("PER_BUCKET_S3_MIN"),
+		PerBucketS3Max:    v.GetInt64("PER_BUCKET_S3_MAX"),
+		Timeout:           timeout,
+		APIKey:            v.GetString("API_KEY"),
+		RateLimitRPS:      v.GetInt("RATE_LIMIT_RPS"),
+		FuseMountPoint:    v.GetString("FUSE_MOUNT_POINT"),
+		ScanDirs:          splitCSV(v.GetString("SCAN_DIRS")),
+
+		ReaddirPageSize:   v.GetInt("READDIR_PAGE_SIZE"),
+		ReaddirMaxEntries: v.GetInt("READDIR_MAX_ENTRIES"),
+		ReaddirCacheTTL:   readdirTTL,
+		FuseKeepCache:     v.GetBool("FUSE_KEEP_CACHE"),
+		FuseDecompress:    v.GetBool("FUSE_DECOMPRESS"),
+		DecompressSpacing: v.GetInt64("DECOMPRESS_CHECKPOINT_BYTES"),
+		DecompressTimeout: decompTimeout,
+
+		PresignDefaultTTL: presignDefault,
+		PresignMaxTTL:     presignMax,
+		PresignKeyMaxTTLs: presignKeys,
+
+		PurgeGracePeriod: purgeGrace,
+		PurgeInterval:    purgeInterval,
+
+		DedupEnabled: v.GetBool("DEDUP_ENABLED"),
+
+		UploadSessionTTL:   sessionTTL,
+		UploadPartSize:     v.GetInt64("UPLOAD_PART_SIZE"),
+		MultipartThreshold: v.GetInt64("MULTIPART_THRESHOLD"),
+
+		VerifyInterval: verifyInterval,
+		VerifyMaxAge:   verifyMaxAge,
+
+		PlacementMode:       v.GetString("PLACEMENT_MODE"),
+		PlacementBucket:     v.GetString("PLACEMENT_BUCKET"),
+		PlacementKey:        v.GetString("PLACEMENT_KEY"),
+		PlacementShardChars: v.GetInt("PLACEMENT_SHARD_CHARS"),
+		PlacementShardDepth: v.GetInt("PLACEMENT_SHARD_DEPTH"),
+		PlacementVersion:    v.GetString("PLACEMENT_VERSION"),
+		PlacementCompress:   v.GetString("PLACEMENT_COMPRESS"),
+	}
+	app.S3BucketRoutes = routes
+	for _, name := range splitCSV(v.GetString("S3_BACKENDS")) {
+		b, err := loadBackend(v, name, app.DefaultS3Backend())
+		if err != nil {
+			return App{}, err
+		}
+		app.S3Backends = append(app.S3Backends, b)
+	}
+	return app, nil
+}
+
+// loadBackend reads S3_BACKEND_<NAME>_* settings. Region, retries and
+// backoff fall back to the top-level values.
+func loadBackend(v *viper.Viper, name string, def S3Backend) (S3Backend, error) {
+	prefix := "S3_BACKEND_" + strings.ToUpper(name) + "_"
+	b := S3Backend{
+		Name: name, Type: v.GetString(prefix + "TYPE"), Root: v.GetString(prefix + "ROOT"), Region: v.GetString(prefix + "REGION"), Endpoint: v.GetString(prefix + "ENDPOINT"),
+		PathStyle: v.GetBool(prefix + "PATH_STYLE"), AccessKeyID: v.GetString(prefix + "ACCESS_KEY_ID"),
+		SecretAccessKey: v.GetString(prefix + "SECRET_ACCESS_KEY"), SessionToken: v.GetString(prefix + "SESSION_TOKEN"),
+		CABundle: v.GetString(prefix + "CA_BUNDLE"), MaxAttempts: v.GetInt(prefix + "MAX_ATTEMPTS"),
+	}
+	if b.Region == "" {
+		b.Region = def.Region
+	}
+	if b.MaxAttempts == 0 {
+		b.MaxAttempts = def.MaxAttempts
+	}
+	b.MaxBackoff = def.MaxBackoff
+	if raw := v.GetString(prefix + "MAX_BACKOFF"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return S3Backend{}, fmt.Errorf("parse %sMAX_BACKOFF: %w", prefix, err)
+		}
+		b.MaxBackoff = d
+	}
+	return b, nil
 }
 
 func splitCSV(in string) []string {
@@ -99,3 +372,34 @@ func splitCSV(in string) []string {
 	}
 	return out
 }
+
+// parseRoutes reads "pattern=backend" pairs separated by commas, keeping
+// their order so the first matching pattern wins.
+func parseRoutes(in string) ([]BucketRoute, error) {
+	var out []BucketRoute
+	for _, pair := range splitCSV(in) {
+		p, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing '=' in %q", pair)
+		}
+		out = append(out, BucketRoute{Pattern: strings.TrimSpace(p), Backend: strings.TrimSpace(name)})
+	}
+	return out, nil
+}
+
+// parseDurationMap reads "name=duration" pairs separated by commas.
+func parseDurationMap(in string) (map[string]time.Duration, error) {
+	out := map[string]time.Duration{}
+	for _, pair := range splitCSV(in) {
+		k, raw, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing '=' in %q", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		out[strings.TrimSpace(k)] = d
+	}
+	return out, nil
+}
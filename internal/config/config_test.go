@@ -0,0 +1,32 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDurationMap(t *testing.T) {
+	got, err := parseDurationMap("a=1h, b = 10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["a"] != time.Hour || got["b"] != 10*time.Minute {
+		t.Fatalf("unexpected map: %v", got)
+	}
+	if _, err := parseDurationMap("broken"); err == nil {
+		t.Fatal("expected error for missing '='")
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	got, err := parseRoutes("archive-*=onprem, data-* = aws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != (BucketRoute{Pattern: "archive-*", Backend: "onprem"}) || got[1].Backend != "aws" {
+		t.Fatalf("unexpected routes: %v", got)
+	}
+	if _, err := parseRoutes("broken"); err == nil {
+		t.Fatal("expected error for missing '='")
+	}
+}
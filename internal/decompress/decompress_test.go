@@ -0,0 +1,251 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// sample is compressible but not trivially so, with long back-references.
+func sample(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"alpha ", "beta ", "gamma ", "delta\n", "epsilon ", "zeta ", "eta ", "theta\n"}
+	var b bytes.Buffer
+	for b.Len() < n {
+		if rng.Intn(50) == 0 {
+			b.WriteByte(byte(rng.Intn(256)))
+			continue
+		}
+		b.WriteString(words[rng.Intn(len(words))])
+		fmt.Fprintf(&b, "%d ", rng.Intn(1000))
+	}
+	return b.Bytes()[:n]
+}
+
+func gzipMembers(t *testing.T, parts ...[]byte) []byte {
+	var out bytes.Buffer
+	for i, p := range parts {
+		w, _ := gzip.NewWriterLevel(&out, []int{gzip.DefaultCompression, gzip.NoCompression, gzip.HuffmanOnly, gzip.BestCompression}[i%4])
+		w.Name = "part"
+		if _, err := w.Write(p); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+	}
+	return out.Bytes()
+}
+
+func checkReads(t *testing.T, ix *Index, comp, want []byte) {
+	t.Helper()
+	if ix.Size != int64(len(want)) {
+		t.Fatalf("size %d, want %d", ix.Size, len(want))
+	}
+	src := bytes.NewReader(comp)
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 50; i++ {
+		off := rng.Int63n(int64(len(want)))
+		n := rng.Intn(100000)
+		r, err := ix.NewReader(src, int64(len(comp)), off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, n)
+		m, err := io.ReadFull(r, got)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatalf("read at %d: %v", off, err)
+		}
+		end := off + int64(n)
+		if end > int64(len(want)) {
+			end = int64(len(want))
+		}
+		if !bytes.Equal(got[:m], want[off:end]) {
+			t.Fatalf("mismatch reading %d bytes at %d", n, off)
+		}
+		r.Close()
+	}
+}
+
+func TestGzipIndex(t *testing.T) {
+	a, b, c, d := sample(700000), sample(1000), sample(300000), sample(400000)
+	want := bytes.Join([][]byte{a, b, c, d}, nil)
+	comp := gzipMembers(t, a, b, c, d)
+	comp = append(comp, 0, 0, 0, 0) // trailing padding is ignored
+	ix, err := Build(Gzip, bytes.NewReader(comp), int64(len(comp)), 64<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ix.Points) < 10 {
+		t.Fatalf("only %d points", len(ix.Points))
+	}
+	checkReads(t, ix, comp, want)
+
+	// One reader walking forward in small steps, as a FUSE handle does.
+	r, err := ix.NewReader(bytes.NewReader(comp), int64(len(comp)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	buf := make([]byte, 4096)
+	for off := int64(0); off < int64(len(want)); off += 3 * int64(len(buf)) {
+		if err := r.SeekTo(off); err != nil {
+			t.Fatal(err)
+		}
+		n, _ := io.ReadFull(r, buf)
+		if !bytes.Equal(buf[:n], want[off:off+int64(n)]) {
+			t.Fatalf("sequential mismatch at %d", off)
+		}
+	}
+
+	data, err := ix.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := &Index{Codec: ix.Codec, Size: ix.Size}
+	if err := back.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	checkReads(t, back, comp, want)
+}
+
+func TestGzipRejectsOtherData(t *testing.T) {
+	if _, err := Build(Gzip, bytes.NewReader([]byte("plain text")), 10, 1<<20); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func zstdFrames(t *testing.T, seekable bool, parts ...[]byte) []byte {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, table bytes.Buffer
+	for _, p := range parts {
+		f := enc.EncodeAll(p, nil)
+		out.Write(f)
+		binary.Write(&table, binary.LittleEndian, [2]uint32{uint32(len(f)), uint32(len(p))})
+	}
+	if seekable {
+		tl := table.Len() + seekTableFooter
+		binary.Write(&out, binary.LittleEndian, [2]uint32{skippableMagic | 0xE, uint32(tl)})
+		out.Write(table.Bytes())
+		binary.Write(&out, binary.LittleEndian, uint32(len(parts)))
+		out.WriteByte(0)
+		binary.Write(&out, binary.LittleEndian, uint32(seekTableMagic))
+	}
+	return out.Bytes()
+}
+
+func TestZstdIndex(t *testing.T) {
+	var parts [][]byte
+	for i := 0; i < 12; i++ {
+		parts = append(parts, sample(50000+i*1000))
+	}
+	want := bytes.Join(parts, nil)
+	for _, seekable := range []bool{false, true} {
+		comp := zstdFrames(t, seekable, parts...)
+		ix, err := Build(Zstd, bytes.NewReader(comp), int64(len(comp)), 100000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ix.Points) != 6 {
+			t.Fatalf("seekable=%v: %d points", seekable, len(ix.Points))
+		}
+		checkReads(t, ix, comp, want)
+	}
+}
+
+func TestZstdStreamWithoutContentSize(t *testing.T) {
+	want := sample(500000)
+	var comp bytes.Buffer
+	w, _ := zstd.NewWriter(&comp)
+	w.Write(want)
+	w.Close()
+	ix, err := Build(Zstd, bytes.NewReader(comp.Bytes()), int64(comp.Len()), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReads(t, ix, comp.Bytes(), want)
+}
+
+func TestCodecFor(t *testing.T) {
+	for name, want := range map[string]string{"a.log.gz": "a.log", "b.zst": "b", ".gz": "", "c.txt": ""} {
+		_, base, ok := CodecFor(name)
+		if base != want || ok != (want != "") {
+			t.Errorf("CodecFor(%q) = %q, %v", name, base, ok)
+		}
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	want := sample(2500000)
+	var comp bytes.Buffer
+	w, err := NewWriter(&comp, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for off := 0; off < len(want); off += 70000 {
+		w.Write(want[off:min(off+70000, len(want))])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	frames, err := seekTable(bytes.NewReader(comp.Bytes()), int64(comp.Len()))
+	if err != nil || len(frames) != 3 {
+		t.Fatalf("seek table: %d frames, %v", len(frames), err)
+	}
+	ix, err := Build(Zstd, bytes.NewReader(comp.Bytes()), int64(comp.Len()), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReads(t, ix, comp.Bytes(), want)
+
+	stream, err := NewStreamReader(Zstd, bytes.NewReader(comp.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(stream)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("stream decode: %d bytes, %v", len(got), err)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var comp bytes.Buffer
+	w, _ := NewWriter(&comp, 0)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := Build(Zstd, bytes.NewReader(comp.Bytes()), int64(comp.Len()), 1<<20)
+	if err != nil || ix.Size != 0 {
+		t.Fatalf("size %v, %v", ix, err)
+	}
+}
+
+func TestReaderSeek(t *testing.T) {
+	want := sample(300000)
+	comp := zstdFrames(t, true, want[:100000], want[100000:200000], want[200000:])
+	ix, err := Build(Zstd, bytes.NewReader(comp), int64(len(comp)), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := ix.NewReader(bytes.NewReader(comp), int64(len(comp)), 0)
+	if n, err := r.Seek(0, io.SeekEnd); err != nil || n != int64(len(want)) {
+		t.Fatalf("seek end: %d, %v", n, err)
+	}
+	if _, err := r.Seek(150000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 1000)
+	if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, want[150000:151000]) {
+		t.Fatalf("read after seek: %v", err)
+	}
+	if n, _ := r.Seek(-500, io.SeekCurrent); n != 150500 {
+		t.Fatalf("seek current: %d", n)
+	}
+}
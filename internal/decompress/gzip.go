@@ -0,0 +1,159 @@
+package decompress
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	gzipFlagHCRC    = 1 << 1
+	gzipFlagExtra   = 1 << 2
+	gzipFlagName    = 1 << 3
+	gzipFlagComment = 1 << 4
+)
+
+var errNotGzip = errors.New("not a gzip stream")
+
+// buildGzip indexes every member of a gzip file. Bytes after the last
+// member that do not start another one are ignored, as gzip(1) does.
+func buildGzip(src io.ReaderAt, size, spacing int64) (*Index, error) {
+	br := &bitReader{r: bufio.NewReaderSize(io.NewSectionReader(src, 0, size), 1<<20)}
+	ix := &Index{Codec: Gzip}
+	for member := 0; br.n < size; member++ {
+		if err := gzipHeader(br); err != nil {
+			if member > 0 {
+				break
+			}
+			return nil, err
+		}
+		in, _ := br.pos()
+		ix.Points = append(ix.Points, Point{Out: ix.Size, In: in, Start: true})
+		f := &inflater{br: br}
+		last := ix.Size
+		err := f.run(func() {
+			if out := ix.Size + f.out; out-last >= spacing {
+				in, bits := br.pos()
+				ix.Points = append(ix.Points, Point{Out: out, In: in, Bits: bits, Window: f.lastWindow()})
+				last = out
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("gzip member %d: %w", member, err)
+		}
+		ix.Size += f.out
+		br.align()
+		for i := 0; i < 8; i++ { // CRC32 and ISIZE
+			if _, err := br.get(8); err != nil {
+				return nil, fmt.Errorf("gzip member %d trailer: %w", member, err)
+			}
+		}
+	}
+	if len(ix.Points) == 0 {
+		return nil, errNotGzip
+	}
+	return ix, nil
+}
+
+func gzipHeader(br *bitReader) error {
+	var h [10]byte
+	for i := range h {
+		c, err := br.get(8)
+		if err != nil {
+			if i == 0 {
+				return errNotGzip
+			}
+			return err
+		}
+		h[i] = byte(c)
+		if i == 1 && (h[0] != 0x1f || h[1] != 0x8b) {
+			return errNotGzip
+		}
+	}
+	if h[2] != 8 {
+		return fmt.Errorf("gzip compression method %d not supported", h[2])
+	}
+	flags := h[3]
+	skip := func(n int) error {
+		for ; n > 0; n-- {
+			if _, err := br.get(8); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	zstr := func() error {
+		for {
+			c, err := br.get(8)
+			if err != nil || c == 0 {
+				return err
+			}
+		}
+	}
+	if flags&gzipFlagExtra != 0 {
+		lo, err := br.get(8)
+		if err != nil {
+			return err
+		}
+		hi, err := br.get(8)
+		if err != nil {
+			return err
+		}
+		if err := skip(int(lo | hi<<8)); err != nil {
+			return err
+		}
+	}
+	if flags&gzipFlagName != 0 {
+		if err := zstr(); err != nil {
+			return err
+		}
+	}
+	if flags&gzipFlagComment != 0 {
+		if err := zstr(); err != nil {
+			return err
+		}
+	}
+	if flags&gzipFlagHCRC != 0 {
+		return skip(2)
+	}
+	return nil
+}
+
+// shiftReader reads a byte stream starting k bits into its first byte, so
+// DEFLATE data that began mid-byte can be handed to compress/flate.
+type shiftReader struct {
+	r    *bufio.Reader
+	k    uint
+	cur  byte
+	have bool
+}
+
+func (s *shiftReader) Read(p []byte) (int, error) {
+	if s.k == 0 {
+		return s.r.Read(p)
+	}
+	n := 0
+	for n < len(p) {
+		if !s.have {
+			c, err := s.r.ReadByte()
+			if err != nil {
+				return n, err
+			}
+			s.cur, s.have = c, true
+		}
+		next, err := s.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				p[n] = s.cur >> s.k
+				n++
+				s.have = false
+			}
+			return n, err
+		}
+		p[n] = s.cur>>s.k | next<<(8-s.k)
+		s.cur = next
+		n++
+	}
+	return n, nil
+}
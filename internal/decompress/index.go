@@ -0,0 +1,152 @@
+// Package decompress presents gzip and zstd objects as their decompressed
+// content with random access. An Index, built once by reading the object
+// through, records points where decoding can resume: DEFLATE block
+// boundaries with the preceding 32 KiB window for gzip, frame starts for
+// zstd. Writer produces seekable zstd for objects compressed on ingest.
+package decompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Codec string
+
+const (
+	Gzip Codec = "gzip"
+	Zstd Codec = "zstd"
+)
+
+// CodecFor returns the codec implied by a file name's extension.
+func CodecFor(name string) (Codec, string, bool) {
+	switch {
+	case strings.HasSuffix(name, ".gz") && len(name) > 3:
+		return Gzip, strings.TrimSuffix(name, ".gz"), true
+	case strings.HasSuffix(name, ".zst") && len(name) > 4:
+		return Zstd, strings.TrimSuffix(name, ".zst"), true
+	}
+	return "", "", false
+}
+
+// Point is a place where decoding can resume. Start marks the beginning of
+// an independent gzip member or zstd frame.
+type Point struct {
+	Out    int64
+	In     int64
+	Bits   uint8
+	Start  bool
+	Window []byte
+}
+
+// Index maps decompressed offsets to resume points.
+type Index struct {
+	Codec  Codec
+	Size   int64
+	Points []Point
+}
+
+// Build reads the compressed object through once and indexes it, keeping
+// at most one resume point per spacing bytes of output.
+func Build(codec Codec, src io.ReaderAt, size, spacing int64) (*Index, error) {
+	switch codec {
+	case Gzip:
+		return buildGzip(src, size, spacing)
+	case Zstd:
+		return buildZstd(src, size, spacing)
+	}
+	return nil, fmt.Errorf("unknown codec %q", codec)
+}
+
+// find returns the last point at or before off.
+func (ix *Index) find(off int64) int {
+	lo, hi := 0, len(ix.Points)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if ix.Points[mid].Out <= off {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+const indexVersion = 1
+
+// MarshalBinary encodes the points; windows make up most of it, so the
+// whole encoding is deflated.
+func (ix *Index) MarshalBinary() ([]byte, error) {
+	var raw bytes.Buffer
+	var tmp [binary.MaxVarintLen64]byte
+	put := func(v int64) { raw.Write(tmp[:binary.PutVarint(tmp[:], v)]) }
+	raw.WriteByte(indexVersion)
+	put(int64(len(ix.Points)))
+	for _, p := range ix.Points {
+		put(p.Out)
+		put(p.In)
+		flags := p.Bits
+		if p.Start {
+			flags |= 0x80
+		}
+		raw.WriteByte(flags)
+		put(int64(len(p.Window)))
+		raw.Write(p.Window)
+	}
+	var out bytes.Buffer
+	w, _ := flate.NewWriter(&out, flate.BestSpeed)
+	if _, err := w.Write(raw.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// UnmarshalBinary decodes points written by MarshalBinary. Codec and Size
+// are stored separately and left untouched.
+func (ix *Index) UnmarshalBinary(data []byte) error {
+	raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return fmt.Errorf("inflate index: %w", err)
+	}
+	r := bytes.NewReader(raw)
+	if v, err := r.ReadByte(); err != nil || v != indexVersion {
+		return errors.New("unsupported index version")
+	}
+	get := func() int64 {
+		v, e := binary.ReadVarint(r)
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	}
+	n := get()
+	if err != nil || n < 0 || n > int64(len(raw)) {
+		return errors.New("corrupt index")
+	}
+	ix.Points = make([]Point, n)
+	for i := range ix.Points {
+		p := &ix.Points[i]
+		p.Out, p.In = get(), get()
+		flags, e := r.ReadByte()
+		if e != nil {
+			return errors.New("corrupt index")
+		}
+		p.Bits, p.Start = flags&7, flags&0x80 != 0
+		wn := get()
+		if err != nil || wn < 0 || wn > windowSize {
+			return errors.New("corrupt index")
+		}
+		p.Window = make([]byte, wn)
+		if _, err := io.ReadFull(r, p.Window); err != nil {
+			return errors.New("corrupt index")
+		}
+	}
+	return nil
+}
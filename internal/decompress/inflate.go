@@ -0,0 +1,340 @@
+package decompress
+
+import (
+	"errors"
+	"io"
+)
+
+const windowSize = 32 << 10
+
+var errCorrupt = errors.New("corrupt deflate stream")
+
+// bitReader reads DEFLATE's LSB-first bit stream one byte at a time, so the
+// position of the next unread bit is always known.
+type bitReader struct {
+	r    io.ByteReader
+	n    int64 // bytes consumed
+	bits uint32
+	nb   uint
+}
+
+func (b *bitReader) get(n uint) (uint32, error) {
+	for b.nb < n {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		b.bits |= uint32(c) << b.nb
+		b.nb += 8
+		b.n++
+	}
+	v := b.bits & (1<<n - 1)
+	b.bits >>= n
+	b.nb -= n
+	return v, nil
+}
+
+// align drops the rest of the current byte.
+func (b *bitReader) align() { b.bits, b.nb = 0, 0 }
+
+// pos returns the byte holding the next unread bit and that bit's index.
+func (b *bitReader) pos() (int64, uint8) {
+	if b.nb == 0 {
+		return b.n, 0
+	}
+	return b.n - 1, uint8(8 - b.nb)
+}
+
+type huffman struct {
+	count  [16]uint16
+	symbol []uint16
+}
+
+func (h *huffman) build(lengths []uint8) error {
+	h.count = [16]uint16{}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	left := 1
+	for l := 1; l < 16; l++ {
+		left <<= 1
+		left -= int(h.count[l])
+		if left < 0 {
+			return errCorrupt
+		}
+	}
+	var offs [16]uint16
+	for l := 1; l < 15; l++ {
+		offs[l+1] = offs[l] + h.count[l]
+	}
+	h.symbol = make([]uint16, len(lengths))
+	for sym, l := range lengths {
+		if l != 0 {
+			h.symbol[offs[l]] = uint16(sym)
+			offs[l]++
+		}
+	}
+	return nil
+}
+
+func (b *bitReader) decode(h *huffman) (int, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l < 16; l++ {
+		bit, err := b.get(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(bit)
+		count := int(h.count[l])
+		if code-count < first {
+			return int(h.symbol[index+code-first]), nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, errCorrupt
+}
+
+var (
+	lenBase   = [29]uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lenExtra  = [29]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase  = [30]uint16{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra = [30]uint8{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+	clOrder   = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+	fixedLit, fixedDist huffman
+)
+
+func init() {
+	var l [288]uint8
+	for i := range l {
+		switch {
+		case i < 144:
+			l[i] = 8
+		case i < 256:
+			l[i] = 9
+		case i < 280:
+			l[i] = 7
+		default:
+			l[i] = 8
+		}
+	}
+	fixedLit.build(l[:])
+	var d [30]uint8
+	for i := range d {
+		d[i] = 5
+	}
+	fixedDist.build(d[:])
+}
+
+// inflater decodes one raw DEFLATE stream, keeping the last 32 KiB of
+// output so a checkpoint can be taken at any block boundary. It only counts
+// output; nothing is returned to the caller.
+type inflater struct {
+	br     *bitReader
+	window [windowSize]byte
+	out    int64 // bytes produced by this stream
+}
+
+func (f *inflater) put(c byte) {
+	f.window[f.out%windowSize] = c
+	f.out++
+}
+
+// lastWindow returns up to 32 KiB of the most recent output, oldest first.
+func (f *inflater) lastWindow() []byte {
+	n := f.out
+	if n > windowSize {
+		n = windowSize
+	}
+	w := make([]byte, n)
+	for i := int64(0); i < n; i++ {
+		w[i] = f.window[(f.out-n+i)%windowSize]
+	}
+	return w
+}
+
+// run decodes blocks until the final one, calling boundary before each
+// block after the first.
+func (f *inflater) run(boundary func()) error {
+	for first := true; ; first = false {
+		if !first {
+			boundary()
+		}
+		final, err := f.br.get(1)
+		if err != nil {
+			return err
+		}
+		typ, err := f.br.get(2)
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 0:
+			err = f.stored()
+		case 1:
+			err = f.codes(&fixedLit, &fixedDist)
+		case 2:
+			err = f.dynamic()
+		default:
+			err = errCorrupt
+		}
+		if err != nil {
+			return err
+		}
+		if final == 1 {
+			return nil
+		}
+	}
+}
+
+func (f *inflater) stored() error {
+	f.br.align()
+	var hdr [4]byte
+	for i := range hdr {
+		c, err := f.br.get(8)
+		if err != nil {
+			return err
+		}
+		hdr[i] = byte(c)
+	}
+	n := uint16(hdr[0]) | uint16(hdr[1])<<8
+	if ^n != uint16(hdr[2])|uint16(hdr[3])<<8 {
+		return errCorrupt
+	}
+	for ; n > 0; n-- {
+		c, err := f.br.get(8)
+		if err != nil {
+			return err
+		}
+		f.put(byte(c))
+	}
+	return nil
+}
+
+func (f *inflater) dynamic() error {
+	hlit, err := f.br.get(5)
+	if err != nil {
+		return err
+	}
+	hdist, err := f.br.get(5)
+	if err != nil {
+		return err
+	}
+	hclen, err := f.br.get(4)
+	if err != nil {
+		return err
+	}
+	nlen, ndist := int(hlit)+257, int(hdist)+1
+	if nlen > 286 || ndist > 30 {
+		return errCorrupt
+	}
+	var cl [19]uint8
+	for i := 0; i < int(hclen)+4; i++ {
+		v, err := f.br.get(3)
+		if err != nil {
+			return err
+		}
+		cl[clOrder[i]] = uint8(v)
+	}
+	var clh huffman
+	if err := clh.build(cl[:]); err != nil {
+		return err
+	}
+	lengths := make([]uint8, nlen+ndist)
+	for i := 0; i < len(lengths); {
+		sym, err := f.br.decode(&clh)
+		if err != nil {
+			return err
+		}
+		if sym < 16 {
+			lengths[i] = uint8(sym)
+			i++
+			continue
+		}
+		var val uint8
+		var rep uint32
+		switch sym {
+		case 16:
+			if i == 0 {
+				return errCorrupt
+			}
+			val = lengths[i-1]
+			rep, err = f.br.get(2)
+			rep += 3
+		case 17:
+			rep, err = f.br.get(3)
+			rep += 3
+		default:
+			rep, err = f.br.get(7)
+			rep += 11
+		}
+		if err != nil {
+			return err
+		}
+		if i+int(rep) > len(lengths) {
+			return errCorrupt
+		}
+		for ; rep > 0; rep-- {
+			lengths[i] = val
+			i++
+		}
+	}
+	if lengths[256] == 0 {
+		return errCorrupt
+	}
+	var lit, dist huffman
+	if err := lit.build(lengths[:nlen]); err != nil {
+		return err
+	}
+	if err := dist.build(lengths[nlen:]); err != nil {
+		return err
+	}
+	return f.codes(&lit, &dist)
+}
+
+func (f *inflater) codes(lit, dist *huffman) error {
+	for {
+		sym, err := f.br.decode(lit)
+		if err != nil {
+			return err
+		}
+		switch {
+		case sym < 256:
+			f.put(byte(sym))
+			continue
+		case sym == 256:
+			return nil
+		case sym > 285:
+			return errCorrupt
+		}
+		sym -= 257
+		extra, err := f.br.get(uint(lenExtra[sym]))
+		if err != nil {
+			return err
+		}
+		n := int(lenBase[sym]) + int(extra)
+		dsym, err := f.br.decode(dist)
+		if err != nil {
+			return err
+		}
+		if dsym > 29 {
+			return errCorrupt
+		}
+		extra, err = f.br.get(uint(distExtra[dsym]))
+		if err != nil {
+			return err
+		}
+		d := int64(distBase[dsym]) + int64(extra)
+		if d > f.out {
+			return errCorrupt
+		}
+		for ; n > 0; n-- {
+			f.put(f.window[(f.out-d)%windowSize])
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package decompress
+
+import (
+	"bufio"
+	"compress/flate"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Reader yields decompressed bytes from a chosen offset onwards. It tracks
+// its position so sequential reads continue without going back to a resume
+// point.
+type Reader struct {
+	ix   *Index
+	src  io.ReaderAt
+	size int64
+	i    int
+	pos  int64
+	cur  io.ReadCloser
+	// want is the offset of a Seek not yet applied; -1 when none is.
+	want int64
+}
+
+// NewReader returns a Reader positioned at decompressed offset off of the
+// object src of the given compressed size.
+func (ix *Index) NewReader(src io.ReaderAt, size, off int64) (*Reader, error) {
+	r := &Reader{ix: ix, src: src, size: size, want: -1}
+	if err := r.SeekTo(off); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Pos returns the decompressed offset of the next byte Read returns.
+func (r *Reader) Pos() int64 { return r.pos }
+
+// SeekTo moves to off, skipping forward from the current position when
+// that is closer than the nearest resume point.
+func (r *Reader) SeekTo(off int64) error {
+	r.want = -1
+	if off > r.ix.Size {
+		off = r.ix.Size
+	}
+	i := r.ix.find(off)
+	if r.cur == nil || off < r.pos || r.ix.Points[i].Out > r.pos {
+		r.Close()
+		r.i, r.pos = i, r.ix.Points[i].Out
+	}
+	if _, err := io.CopyN(io.Discard, r, off-r.pos); err != nil {
+		return fmt.Errorf("skip to %d: %w", off, err)
+	}
+	return nil
+}
+
+// Seek implements io.Seeker. The move is made by the next Read, so seeking
+// to the end to learn the size decodes nothing.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	cur := r.pos
+	if r.want >= 0 {
+		cur = r.want
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += cur
+	case io.SeekEnd:
+		offset += r.ix.Size
+	default:
+		return 0, fmt.Errorf("seek: invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek: negative position %d", offset)
+	}
+	r.want = offset
+	return offset, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.want >= 0 {
+		if err := r.SeekTo(r.want); err != nil {
+			return 0, err
+		}
+	}
+	if rest := r.ix.Size - r.pos; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	if len(p) == 0 {
+		return 0, io.EOF
+	}
+	for {
+		if r.cur == nil {
+			if r.i >= len(r.ix.Points) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			cur, err := r.open(r.ix.Points[r.i])
+			if err != nil {
+				return 0, err
+			}
+			r.cur = cur
+		}
+		n, err := r.cur.Read(p)
+		r.pos += int64(n)
+		if err == io.EOF {
+			// A gzip member ended; carry on from the next one.
+			r.cur.Close()
+			r.cur = nil
+			r.i = r.nextStart()
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (r *Reader) nextStart() int {
+	for j := r.i + 1; j < len(r.ix.Points); j++ {
+		if p := r.ix.Points[j]; p.Start && p.Out >= r.pos {
+			return j
+		}
+	}
+	return len(r.ix.Points)
+}
+
+func (r *Reader) open(p Point) (io.ReadCloser, error) {
+	sec := io.NewSectionReader(r.src, p.In, r.size-p.In)
+	switch r.ix.Codec {
+	case Gzip:
+		return flate.NewReaderDict(&shiftReader{r: bufio.NewReaderSize(sec, 1<<20), k: uint(p.Bits)}, p.Window), nil
+	case Zstd:
+		d, err := zstd.NewReader(bufio.NewReaderSize(sec, 1<<20), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unknown codec %q", r.ix.Codec)
+}
+
+func (r *Reader) Close() error {
+	if r.cur != nil {
+		r.cur.Close()
+		r.cur = nil
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package decompress
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultFrameSize is the input size of each frame Writer emits.
+const DefaultFrameSize = 1 << 20
+
+// Writer compresses to the zstd seekable format: independent frames of
+// frameSize input bytes followed by a seek table, so Build only reads the
+// tail of what it wrote.
+type Writer struct {
+	w     io.Writer
+	enc   *zstd.Encoder
+	size  int
+	buf   []byte
+	out   []byte
+	table []byte
+	n     uint32
+	err   error
+}
+
+func NewWriter(w io.Writer, frameSize int) (*Writer, error) {
+	if frameSize <= 0 {
+		frameSize = DefaultFrameSize
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, enc: enc, size: frameSize, buf: make([]byte, 0, frameSize)}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	n := 0
+	for w.err == nil && n < len(p) {
+		c := copy(w.buf[len(w.buf):w.size], p[n:])
+		w.buf = w.buf[:len(w.buf)+c]
+		n += c
+		if len(w.buf) == w.size {
+			w.flush()
+		}
+	}
+	return n, w.err
+}
+
+func (w *Writer) flush() {
+	w.out = w.enc.EncodeAll(w.buf, w.out[:0])
+	if _, err := w.w.Write(w.out); err != nil {
+		w.err = fmt.Errorf("write zstd frame: %w", err)
+		return
+	}
+	w.table = binary.LittleEndian.AppendUint32(w.table, uint32(len(w.out)))
+	w.table = binary.LittleEndian.AppendUint32(w.table, uint32(len(w.buf)))
+	w.n++
+	w.buf = w.buf[:0]
+}
+
+// Close writes the last frame and the seek table. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buf) > 0 || w.n == 0 {
+		w.flush()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	tail := binary.LittleEndian.AppendUint32(nil, skippableMagic|0xE)
+	tail = binary.LittleEndian.AppendUint32(tail, uint32(len(w.table)+seekTableFooter))
+	tail = append(tail, w.table...)
+	tail = binary.LittleEndian.AppendUint32(tail, w.n)
+	tail = append(tail, 0)
+	tail = binary.LittleEndian.AppendUint32(tail, seekTableMagic)
+	if _, err := w.w.Write(tail); err != nil {
+		w.err = fmt.Errorf("write zstd seek table: %w", err)
+		return w.err
+	}
+	w.err = errors.New("decompress: writer closed")
+	return nil
+}
+
+// NewStreamReader decodes a whole compressed stream in order, without an
+// index.
+func NewStreamReader(codec Codec, r io.Reader) (io.ReadCloser, error) {
+	switch codec {
+	case Zstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	}
+	return nil, fmt.Errorf("unknown codec %q", codec)
+}
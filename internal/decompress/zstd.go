@@ -0,0 +1,210 @@
+package decompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	zstdMagic         = 0xFD2FB528
+	skippableMagic    = 0x184D2A50
+	skippableMask     = 0xFFFFFFF0
+	seekTableMagic    = 0x8F92EAB1
+	seekTableFooter   = 9
+	seekTableChecksum = 1 << 7
+)
+
+var errNotZstd = errors.New("not a zstd stream")
+
+type zstdFrame struct {
+	in, inLen, outLen int64
+}
+
+// buildZstd indexes frame starts. A seek table (the zstd seekable format's
+// trailing skippable frame) is used when present; otherwise frame headers
+// are walked, and frames that do not record their content size are decoded
+// to measure it.
+func buildZstd(src io.ReaderAt, size, spacing int64) (*Index, error) {
+	frames, err := seekTable(src, size)
+	if err != nil {
+		return nil, err
+	}
+	if frames == nil {
+		if frames, err = walkFrames(src, size); err != nil {
+			return nil, err
+		}
+	}
+	return framesIndex(frames, spacing)
+}
+
+// SeekTableIndex indexes a zstd object from its seek table alone, reading
+// only the tail. ok is false when the object has no seek table.
+func SeekTableIndex(src io.ReaderAt, size, spacing int64) (ix *Index, ok bool, err error) {
+	frames, err := seekTable(src, size)
+	if err != nil || frames == nil {
+		return nil, false, err
+	}
+	ix, err = framesIndex(frames, spacing)
+	return ix, err == nil, err
+}
+
+func framesIndex(frames []zstdFrame, spacing int64) (*Index, error) {
+	if len(frames) == 0 {
+		return nil, errNotZstd
+	}
+	ix := &Index{Codec: Zstd}
+	last := int64(-1)
+	for _, f := range frames {
+		if last < 0 || ix.Size-last >= spacing {
+			ix.Points = append(ix.Points, Point{Out: ix.Size, In: f.in, Start: true})
+			last = ix.Size
+		}
+		ix.Size += f.outLen
+	}
+	return ix, nil
+}
+
+func seekTable(src io.ReaderAt, size int64) ([]zstdFrame, error) {
+	if size < seekTableFooter+8 {
+		return nil, nil
+	}
+	var foot [seekTableFooter]byte
+	if _, err := src.ReadAt(foot[:], size-seekTableFooter); err != nil {
+		return nil, fmt.Errorf("read seek table footer: %w", err)
+	}
+	if binary.LittleEndian.Uint32(foot[5:]) != seekTableMagic {
+		return nil, nil
+	}
+	n := int64(binary.LittleEndian.Uint32(foot[:4]))
+	entry := int64(8)
+	if foot[4]&seekTableChecksum != 0 {
+		entry = 12
+	}
+	tableLen := n*entry + seekTableFooter
+	start := size - tableLen - 8
+	if start < 0 {
+		return nil, errors.New("zstd seek table larger than object")
+	}
+	table := make([]byte, tableLen+8)
+	if _, err := src.ReadAt(table, start); err != nil {
+		return nil, fmt.Errorf("read seek table: %w", err)
+	}
+	if binary.LittleEndian.Uint32(table)&skippableMask != skippableMagic || int64(binary.LittleEndian.Uint32(table[4:])) != tableLen {
+		return nil, errors.New("malformed zstd seek table")
+	}
+	frames := make([]zstdFrame, n)
+	var in int64
+	for i := range frames {
+		e := table[8+int64(i)*entry:]
+		frames[i] = zstdFrame{in: in, inLen: int64(binary.LittleEndian.Uint32(e)), outLen: int64(binary.LittleEndian.Uint32(e[4:]))}
+		in += frames[i].inLen
+	}
+	if in != start {
+		return nil, errors.New("zstd seek table does not match object size")
+	}
+	return frames, nil
+}
+
+func walkFrames(src io.ReaderAt, size int64) ([]zstdFrame, error) {
+	var frames []zstdFrame
+	for off := int64(0); off < size; {
+		var m [4]byte
+		if _, err := src.ReadAt(m[:], off); err != nil {
+			return nil, fmt.Errorf("read frame magic at %d: %w", off, err)
+		}
+		magic := binary.LittleEndian.Uint32(m[:])
+		if magic&skippableMask == skippableMagic {
+			var l [4]byte
+			if _, err := src.ReadAt(l[:], off+4); err != nil {
+				return nil, fmt.Errorf("read skippable frame at %d: %w", off, err)
+			}
+			off += 8 + int64(binary.LittleEndian.Uint32(l[:]))
+			continue
+		}
+		if magic != zstdMagic {
+			if off == 0 {
+				return nil, errNotZstd
+			}
+			return nil, fmt.Errorf("unexpected data at offset %d", off)
+		}
+		f, err := frameAt(src, off)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, f)
+		off += f.inLen
+	}
+	return frames, nil
+}
+
+// frameAt parses the frame header and block headers of the frame at off.
+func frameAt(src io.ReaderAt, off int64) (zstdFrame, error) {
+	var hdr [14]byte
+	n, err := src.ReadAt(hdr[:], off)
+	if n < 6 {
+		return zstdFrame{}, fmt.Errorf("read frame header at %d: %w", off, err)
+	}
+	fhd := hdr[4]
+	single := fhd>>5&1 == 1
+	pos := 5
+	if !single {
+		pos++
+	}
+	pos += [4]int{0, 1, 2, 4}[fhd&3]
+	fcsLen := [4]int{0, 2, 4, 8}[fhd>>6]
+	if fcsLen == 0 && single {
+		fcsLen = 1
+	}
+	if pos+fcsLen > n {
+		return zstdFrame{}, fmt.Errorf("short frame header at %d", off)
+	}
+	outLen := int64(-1)
+	switch fcsLen {
+	case 1:
+		outLen = int64(hdr[pos])
+	case 2:
+		outLen = int64(binary.LittleEndian.Uint16(hdr[pos:])) + 256
+	case 4:
+		outLen = int64(binary.LittleEndian.Uint32(hdr[pos:]))
+	case 8:
+		outLen = int64(binary.LittleEndian.Uint64(hdr[pos:]))
+	}
+	p := off + int64(pos+fcsLen)
+	for {
+		var b [3]byte
+		if _, err := src.ReadAt(b[:], p); err != nil {
+			return zstdFrame{}, fmt.Errorf("read block header at %d: %w", p, err)
+		}
+		h := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+		bsize := int64(h >> 3)
+		switch h >> 1 & 3 {
+		case 1:
+			bsize = 1
+		case 3:
+			return zstdFrame{}, fmt.Errorf("reserved block type at %d", p)
+		}
+		p += 3 + bsize
+		if h&1 == 1 {
+			break
+		}
+	}
+	if fhd>>2&1 == 1 {
+		p += 4
+	}
+	f := zstdFrame{in: off, inLen: p - off, outLen: outLen}
+	if f.outLen < 0 {
+		d, err := zstd.NewReader(io.NewSectionReader(src, f.in, f.inLen), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return zstdFrame{}, err
+		}
+		defer d.Close()
+		if f.outLen, err = io.Copy(io.Discard, d); err != nil {
+			return zstdFrame{}, fmt.Errorf("decode frame at %d: %w", off, err)
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,87 @@
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"syscall"
+
+	"github.com/example/fuses3redispostgres/internal/cache"
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/example/fuses3redispostgres/internal/s3io"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func (h *fileHandle) read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	block, size := h.root.block, h.obj.Size
+	if off >= size {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := off + int64(len(dest))
+	if end > size {
+		end = size
+	}
+	h.ra.access(off, end-off, off/block, (end-1)/block, (size-1)/block)
+	n := 0
+	for pos := off; pos < end; {
+		idx := pos / block
+		blk, err := h.ra.block(ctx, idx)
+		if err != nil {
+			return nil, readErrno(err)
+		}
+		shift := pos - idx*block
+		if shift >= int64(len(blk.Data)) {
+			blk.Release()
+			break
+		}
+		c := copy(dest[n:end-off], blk.Data[shift:])
+		blk.Release()
+		n += c
+		pos += int64(c)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+// readErrno maps a failed block fetch to what the reading process sees.
+func readErrno(err error) syscall.Errno {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return syscall.ETIMEDOUT
+	case errors.Is(err, context.Canceled):
+		return syscall.EINTR
+	case errors.Is(err, s3io.ErrThrottled), errors.Is(err, errIndexPending):
+		return syscall.EAGAIN
+	case errors.Is(err, s3io.ErrChanged):
+		return syscall.ESTALE
+	}
+	return syscall.EIO
+}
+
+// fetchBlock returns block idx of obj from the disk cache or the store. The
+// caller owns one reference to the block.
+func (r *Root) fetchBlock(ctx context.Context, obj metadata.Object, idx int64) (*s3io.Block, error) {
+	k := cache.BlockKey{Bucket: obj.Bucket, Key: obj.Key, VersionID: obj.Version(), ETag: obj.ETag, Index: idx}
+	if r.cache != nil {
+		if buf, ok := r.cache.Get(k); ok {
+			return s3io.NewBlock(buf), nil
+		}
+	}
+	blk, err := r.readBlock(ctx, obj, idx)
+	if err != nil {
+		return nil, err
+	}
+	if r.cache != nil {
+		_ = r.cache.Put(k, blk.Data)
+	}
+	return blk, nil
+}
+
+// readBlock fetches block idx of obj from the store, bypassing the disk
+// cache.
+func (r *Root) readBlock(ctx context.Context, obj metadata.Object, idx int64) (*s3io.Block, error) {
+	start := idx * r.block
+	end := start + r.block - 1
+	if end >= obj.Size {
+		end = obj.Size - 1
+	}
+	return r.reader.GetRange(ctx, obj.Bucket, obj.Key, obj.Version(), obj.ETag, start, end)
+}
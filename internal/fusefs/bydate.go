@@ -0,0 +1,158 @@
+package fusefs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+type dateLevel int
+
+const (
+	levelRoot dateLevel = iota
+	levelYear
+	levelMonth
+	levelDay
+)
+
+// DateDir is a node of /by-date/YYYY/MM/DD/<virtual path>. Below the day
+// level, path holds the virtual directory being browsed in that partition.
+type DateDir struct {
+	fs.Inode
+	root  *Root
+	level dateLevel
+	date  time.Time
+	path  string
+}
+
+func (d *DateDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	switch d.level {
+	case levelRoot:
+		return d.root.listDir("by-date", d.root.listYears), 0
+	case levelYear:
+		return d.root.listDir("by-date:"+d.date.Format("2006"), d.root.listDates("month", d.date, d.date.AddDate(1, 0, 0), "01")), 0
+	case levelMonth:
+		return d.root.listDir("by-date:"+d.date.Format("2006-01"), d.root.listDates("day", d.date, d.date.AddDate(0, 1, 0), "02")), 0
+	}
+	return d.root.listDir("by-date:"+d.date.Format("2006-01-02")+":"+d.path, d.root.listPrefix(d.path, d.date)), 0
+}
+
+func (d *DateDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if d.level == levelDay {
+		return d.lookupDay(ctx, name, out)
+	}
+	var from, to time.Time
+	var unit string
+	switch d.level {
+	case levelRoot:
+		y, ok := parseDatePart(name, 4, 1, 9999)
+		if !ok {
+			return nil, syscall.ENOENT
+		}
+		from, to, unit = time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(y+1, 1, 1, 0, 0, 0, 0, time.UTC), "year"
+	case levelYear:
+		m, ok := parseDatePart(name, 2, 1, 12)
+		if !ok {
+			return nil, syscall.ENOENT
+		}
+		from = time.Date(d.date.Year(), time.Month(m), 1, 0, 0, 0, 0, time.UTC)
+		to, unit = from.AddDate(0, 1, 0), "month"
+	case levelMonth:
+		day, ok := parseDatePart(name, 2, 1, 31)
+		if !ok {
+			return nil, syscall.ENOENT
+		}
+		from = time.Date(d.date.Year(), d.date.Month(), day, 0, 0, 0, 0, time.UTC)
+		if from.Month() != d.date.Month() {
+			return nil, syscall.ENOENT
+		}
+		to, unit = from.AddDate(0, 0, 1), "day"
+	}
+	found, err := d.root.repo.ListDates(ctx, unit, from, to, 1)
+	if err != nil {
+		return nil, syscall.EIO
+	}
+	if len(found) == 0 {
+		return nil, syscall.ENOENT
+	}
+	child := &DateDir{root: d.root, level: d.level + 1, date: from, path: "/"}
+	return d.NewInode(ctx, child, fs.StableAttr{Mode: syscall.S_IFDIR}), 0
+}
+
+func (d *DateDir) lookupDay(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	vp := metadata.JoinVirtualPath(d.path, name)
+	obj, err := d.root.resolver.ResolveOnDate(ctx, vp, d.date)
+	if err == nil {
+		f := &File{obj: obj, root: d.root, resolve: func(ctx context.Context) (metadata.Object, error) {
+			return d.root.resolver.ResolveOnDate(ctx, vp, d.date)
+		}}
+		fillAttr(&out.Attr, obj)
+		out.SetAttrTimeout(2 * time.Second)
+		return d.NewInode(ctx, f, fs.StableAttr{Mode: syscall.S_IFREG}), 0
+	}
+	ok, err := d.root.repo.PrefixExists(ctx, vp, d.date)
+	if err != nil {
+		return nil, syscall.EIO
+	}
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	child := &DateDir{root: d.root, level: levelDay, date: d.date, path: vp}
+	return d.NewInode(ctx, child, fs.StableAttr{Mode: syscall.S_IFDIR}), 0
+}
+
+func (r *Root) listYears(ctx context.Context, cursor string, limit int) ([]fuse.DirEntry, string, error) {
+	from := time.Time{}
+	if cursor != "" {
+		y, _ := strconv.Atoi(cursor)
+		from = time.Date(y+1, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return r.datePage(ctx, "year", from, maxDate, "2006", limit)
+}
+
+func (r *Root) listDates(unit string, from, to time.Time, layout string) pageFunc {
+	return func(ctx context.Context, cursor string, limit int) ([]fuse.DirEntry, string, error) {
+		start := from
+		if cursor != "" {
+			n, _ := strconv.Atoi(cursor)
+			if unit == "month" {
+				start = time.Date(from.Year(), time.Month(n+1), 1, 0, 0, 0, 0, time.UTC)
+			} else {
+				start = time.Date(from.Year(), from.Month(), n+1, 0, 0, 0, 0, time.UTC)
+			}
+		}
+		return r.datePage(ctx, unit, start, to, layout, limit)
+	}
+}
+
+func (r *Root) datePage(ctx context.Context, unit string, from, to time.Time, layout string, limit int) ([]fuse.DirEntry, string, error) {
+	dates, err := r.repo.ListDates(ctx, unit, from, to, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	entries := make([]fuse.DirEntry, 0, len(dates))
+	for _, d := range dates {
+		entries = append(entries, fuse.DirEntry{Name: d.Format(layout), Mode: syscall.S_IFDIR})
+	}
+	if len(dates) < limit {
+		return entries, "", nil
+	}
+	return entries, entries[len(entries)-1].Name, nil
+}
+
+func parseDatePart(name string, width, min, max int) (int, bool) {
+	if len(name) != width {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name)
+	if err != nil || n < min || n > max || fmt.Sprintf("%0*d", width, n) != name {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,26 @@
+package fusefs
+
+import "testing"
+
+func TestParseDatePart(t *testing.T) {
+	cases := []struct {
+		in    string
+		width int
+		max   int
+		want  int
+		ok    bool
+	}{
+		{"2024", 4, 9999, 2024, true},
+		{"01", 2, 12, 1, true},
+		{"1", 2, 12, 0, false},
+		{"13", 2, 12, 0, false},
+		{"+1", 2, 12, 0, false},
+		{"README", 4, 9999, 0, false},
+	}
+	for _, c := range cases {
+		got, ok := parseDatePart(c.in, c.width, 1, c.max)
+		if got != c.want || ok != c.ok {
+			t.Fatalf("parseDatePart(%q) = %d, %v", c.in, got, ok)
+		}
+	}
+}
@@ -0,0 +1,511 @@
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/decompress"
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/example/fuses3redispostgres/internal/s3io"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// DecompDir mirrors TreeDir under /decompressed, listing only subdirectories
+// and .gz/.zst objects, the latter without their extension.
+type DecompDir struct {
+	fs.Inode
+	root *Root
+	path string
+}
+
+func (d *DecompDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	return d.root.listDir("decompressed:"+d.path, compressedOnly(d.root.listChildren(d.path))), 0
+}
+
+// Lookup prefers a directory over a compressed file of the same name, like
+// TreeDir.
+func (d *DecompDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	vp := metadata.JoinVirtualPath(d.path, name)
+	_, err := d.root.repo.StatDir(ctx, vp)
+	if err == nil {
+		return d.NewInode(ctx, &DecompDir{root: d.root, path: vp}, fs.StableAttr{Mode: syscall.S_IFDIR}), 0
+	}
+	if !errors.Is(err, metadata.ErrNotFound) {
+		return nil, syscall.EIO
+	}
+	for _, ext := range []string{".gz", ".zst"} {
+		obj, err := d.root.resolver.Resolve(ctx, vp+ext)
+		if errors.Is(err, metadata.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, syscall.EIO
+		}
+		codec, _, _ := decompress.CodecFor(vp + ext)
+		ix, err := d.root.decompIndex(ctx, obj, codec, false)
+		if err != nil {
+			return nil, readErrno(err)
+		}
+		f := &DecompFile{root: d.root, codec: codec, obj: obj, ix: ix, resolve: func(ctx context.Context) (metadata.Object, error) {
+			return d.root.resolver.Resolve(ctx, vp+ext)
+		}}
+		fillDecompAttr(&out.Attr, obj, ix)
+		out.SetAttrTimeout(2 * time.Second)
+		return d.NewInode(ctx, f, fs.StableAttr{Mode: syscall.S_IFREG}), 0
+	}
+	return nil, syscall.ENOENT
+}
+
+func compressedOnly(fetch pageFunc) pageFunc {
+	return func(ctx context.Context, cursor string, limit int) ([]fuse.DirEntry, string, error) {
+		entries, next, err := fetch(ctx, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		kept := entries[:0]
+		for _, e := range entries {
+			if e.Mode&syscall.S_IFDIR != 0 {
+				kept = append(kept, e)
+			} else if _, base, ok := decompress.CodecFor(e.Name); ok {
+				e.Name = base
+				kept = append(kept, e)
+			}
+		}
+		return kept, next, nil
+	}
+}
+
+func fillDecompAttr(out *fuse.Attr, obj metadata.Object, ix *decompress.Index) {
+	fillAttr(out, obj)
+	out.Size = uint64(ix.Size)
+}
+
+// DecompFile presents the decompressed content of one object. Like File it
+// pins the object version on open; the index is built on first use and
+// kept in Postgres keyed by the object's ETag.
+type DecompFile struct {
+	fs.Inode
+	root    *Root
+	codec   decompress.Codec
+	resolve func(context.Context) (metadata.Object, error)
+
+	mu  sync.Mutex
+	obj metadata.Object
+	ix  *decompress.Index
+}
+
+var (
+	_ fs.NodeGetattrer = (*DecompFile)(nil)
+	_ fs.NodeOpener    = (*DecompFile)(nil)
+	_ fs.NodeReader    = (*DecompFile)(nil)
+)
+
+func (f *DecompFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if h, ok := fh.(*decompHandle); ok {
+		fillDecompAttr(&out.Attr, h.obj, h.ix)
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fillDecompAttr(&out.Attr, f.obj, f.ix)
+	return 0
+}
+
+func (f *DecompFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	obj, err := f.resolve(ctx)
+	switch {
+	case errors.Is(err, metadata.ErrNotFound):
+		return nil, 0, syscall.ENOENT
+	case err != nil:
+		obj = f.snapshot()
+	}
+	ix, err := f.root.decompIndex(ctx, obj, f.codec, true)
+	if err != nil {
+		return nil, 0, readErrno(err)
+	}
+	h, err := f.root.newDecompHandle(ctx, obj, ix)
+	if err != nil {
+		return nil, 0, readErrno(err)
+	}
+	f.mu.Lock()
+	unchanged := f.obj.ETag == obj.ETag
+	f.obj, f.ix = obj, ix
+	f.mu.Unlock()
+	switch {
+	case !f.root.keepCache:
+		return h, fuse.FOPEN_DIRECT_IO, 0
+	case unchanged:
+		return h, fuse.FOPEN_KEEP_CACHE, 0
+	default:
+		return h, 0, 0
+	}
+}
+
+func (f *DecompFile) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h, ok := fh.(*decompHandle)
+	if !ok {
+		f.mu.Lock()
+		obj, ix := f.obj, f.ix
+		f.mu.Unlock()
+		var err error
+		if h, err = f.root.newDecompHandle(ctx, obj, ix); err != nil {
+			return nil, readErrno(err)
+		}
+		defer h.Release(ctx)
+	}
+	return h.read(dest, off)
+}
+
+func (f *DecompFile) snapshot() metadata.Object {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.obj
+}
+
+// decompHandle keeps one decoder per open so sequential reads carry on
+// where the previous one stopped. src holds the compressed bytes ix refers
+// to, size long.
+type decompHandle struct {
+	obj  metadata.Object
+	ix   *decompress.Index
+	src  contentSource
+	size int64
+
+	mu sync.Mutex
+	rd *decompress.Reader
+}
+
+var _ fs.FileReleaser = (*decompHandle)(nil)
+
+// newDecompHandle opens the /decompressed view of obj, whose index ix is
+// over its logical content.
+func (r *Root) newDecompHandle(ctx context.Context, obj metadata.Object, ix *decompress.Index) (*decompHandle, error) {
+	src, err := r.decodeContent(ctx, r.newBlockSource(obj), true)
+	if err != nil {
+		return nil, err
+	}
+	return &decompHandle{obj: obj, ix: ix, src: src, size: obj.LogicalSize()}, nil
+}
+
+func (h *decompHandle) read(dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var err error
+	if h.rd == nil {
+		h.rd, err = h.ix.NewReader(h.src, h.size, off)
+	} else {
+		err = h.rd.SeekTo(off)
+	}
+	if err != nil {
+		h.reset()
+		return nil, readErrno(err)
+	}
+	n, err := io.ReadFull(h.rd, dest)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		h.reset()
+		return nil, readErrno(err)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+// reset drops the decoder after an error so the next read starts clean.
+func (h *decompHandle) reset() {
+	if h.rd != nil {
+		h.rd.Close()
+		h.rd = nil
+	}
+}
+
+func (h *decompHandle) Release(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reset()
+	h.src.close()
+	return 0
+}
+
+// errIndexPending is returned while a seek index is still being built.
+var errIndexPending = errors.New("decompress index is being built")
+
+// indexBuild is one background read-through of an object. waiters counts
+// the callers blocked on it; when the last one is interrupted the build is
+// cancelled.
+type indexBuild struct {
+	done    chan struct{}
+	ix      *decompress.Index
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// decompIndex returns the index of codec over the logical content of obj:
+// its stored bytes, or what they decode to for objects compressed on ingest.
+// Indexes are keyed by codec as well as ETag, so both layers of such an
+// object are kept apart. A cached or stored index, or the seek table of a
+// zstd object, is used directly. Otherwise the object is read
+// through by a background build bounded by DECOMPRESS_INDEX_TIMEOUT, which
+// concurrent callers share: with wait false decompIndex returns
+// errIndexPending until it finishes, with wait true it blocks until then or
+// until ctx is interrupted.
+func (r *Root) decompIndex(ctx context.Context, obj metadata.Object, codec decompress.Codec, wait bool) (*decompress.Index, error) {
+	name := indexName(obj, codec)
+	k := obj.Bucket + "\x00" + obj.Key + "\x00" + obj.ETag + "\x00" + name
+	if ix, ok := r.indexes.Get(k); ok {
+		return ix, nil
+	}
+	qctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	stored, err := r.repo.GetDecompressIndex(qctx, obj.Bucket, obj.Key, obj.ETag, name)
+	if err == nil {
+		ix := &decompress.Index{Codec: codec, Size: stored.DecompressedSize}
+		if err := ix.UnmarshalBinary(stored.Points); err == nil {
+			r.indexes.Set(k, ix)
+			return ix, nil
+		}
+	} else if err != nil && !errors.Is(err, metadata.ErrNotFound) {
+		return nil, err
+	}
+	if codec == decompress.Zstd {
+		src, err := r.decodeContent(qctx, r.newIndexSource(qctx, obj), false)
+		if err != nil {
+			return nil, err
+		}
+		ix, ok, err := decompress.SeekTableIndex(src, obj.LogicalSize(), r.decompSpacing)
+		src.close()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			r.indexes.Set(k, ix)
+			return ix, nil
+		}
+	}
+
+	r.buildMu.Lock()
+	b, ok := r.builds[k]
+	if !ok {
+		bctx, cancel := context.WithTimeout(context.Background(), r.indexTimeout)
+		b = &indexBuild{done: make(chan struct{}), cancel: cancel}
+		r.builds[k] = b
+		go r.buildIndex(bctx, k, b, obj, codec, name)
+	}
+	if !wait {
+		r.buildMu.Unlock()
+		select {
+		case <-b.done:
+			return b.ix, b.err
+		default:
+			return nil, errIndexPending
+		}
+	}
+	b.waiters++
+	r.buildMu.Unlock()
+	select {
+	case <-b.done:
+		return b.ix, b.err
+	case <-ctx.Done():
+		r.buildMu.Lock()
+		if b.waiters--; b.waiters == 0 {
+			b.cancel()
+			if r.builds[k] == b {
+				delete(r.builds, k)
+			}
+		}
+		r.buildMu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// buildIndex reads obj through around the disk cache, so indexing does not
+// evict blocks that readers use, and stores the result in Postgres.
+func (r *Root) buildIndex(ctx context.Context, k string, b *indexBuild, obj metadata.Object, codec decompress.Codec, name string) {
+	defer b.cancel()
+	b.ix, b.err = func() (*decompress.Index, error) {
+		src, err := r.decodeContent(ctx, r.newIndexSource(ctx, obj), true)
+		if err != nil {
+			return nil, err
+		}
+		defer src.close()
+		ix, err := decompress.Build(codec, src, obj.LogicalSize(), r.decompSpacing)
+		if err != nil {
+			return nil, err
+		}
+		points, err := ix.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.repo.PutDecompressIndex(ctx, obj.Bucket, obj.Key, obj.ETag, metadata.DecompressIndex{Codec: name, DecompressedSize: ix.Size, Points: points}); err != nil {
+			return nil, err
+		}
+		r.indexes.Set(k, ix)
+		return ix, nil
+	}()
+	r.buildMu.Lock()
+	if r.builds[k] == b {
+		delete(r.builds, k)
+	}
+	r.buildMu.Unlock()
+	close(b.done)
+}
+
+// storedIndex returns the index of obj.Codec over the stored bytes of an
+// object compressed on ingest.
+func (r *Root) storedIndex(ctx context.Context, obj metadata.Object, wait bool) (*decompress.Index, error) {
+	codec := decompress.Codec(obj.Codec)
+	obj.Codec = ""
+	return r.decompIndex(ctx, obj, codec, wait)
+}
+
+// indexName is the codec an index is stored under: the codec itself, or
+// for content inside an object compressed on ingest, "<stored>/<codec>".
+func indexName(obj metadata.Object, codec decompress.Codec) string {
+	if obj.Codec == "" {
+		return string(codec)
+	}
+	return obj.Codec + "/" + string(codec)
+}
+
+// contentSource is an io.ReaderAt over an object that must be closed.
+type contentSource interface {
+	io.ReaderAt
+	close()
+}
+
+// decodeContent wraps src so it reads the logical content of its object,
+// decoding objects compressed on ingest. It takes ownership of src.
+func (r *Root) decodeContent(ctx context.Context, src *blockSource, wait bool) (contentSource, error) {
+	if src.obj.Codec == "" {
+		return src, nil
+	}
+	ix, err := r.storedIndex(ctx, src.obj, wait)
+	if err != nil {
+		src.close()
+		return nil, err
+	}
+	return &decodedSource{ix: ix, src: src}, nil
+}
+
+// decodedSource reads what an object compressed on ingest decodes to,
+// keeping one decoder so sequential reads carry on.
+type decodedSource struct {
+	ix  *decompress.Index
+	src *blockSource
+
+	mu sync.Mutex
+	rd *decompress.Reader
+}
+
+func (s *decodedSource) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if off >= s.ix.Size {
+		return 0, io.EOF
+	}
+	var err error
+	if s.rd == nil {
+		s.rd, err = s.ix.NewReader(s.src, s.src.obj.Size, off)
+	} else {
+		err = s.rd.SeekTo(off)
+	}
+	if err != nil {
+		s.resetLocked()
+		return 0, err
+	}
+	n, err := io.ReadFull(s.rd, p)
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		err = io.EOF
+	case err != nil && !errors.Is(err, io.EOF):
+		s.resetLocked()
+	}
+	return n, err
+}
+
+func (s *decodedSource) resetLocked() {
+	if s.rd != nil {
+		s.rd.Close()
+		s.rd = nil
+	}
+}
+
+func (s *decodedSource) close() {
+	s.mu.Lock()
+	s.resetLocked()
+	s.mu.Unlock()
+	s.src.close()
+}
+
+// blockSource reads a pinned object through the block cache as an
+// io.ReaderAt, holding on to the last block so small sequential reads do
+// not refetch it.
+type blockSource struct {
+	root   *Root
+	obj    metadata.Object
+	ctx    context.Context
+	cached bool
+
+	mu   sync.Mutex
+	idx  int64
+	last *s3io.Block
+}
+
+func (r *Root) newBlockSource(obj metadata.Object) *blockSource {
+	return &blockSource{root: r, obj: obj, ctx: context.Background(), cached: true, idx: -1}
+}
+
+// newIndexSource is a blockSource for index builds: reads stop once ctx
+// ends and skip the disk cache.
+func (r *Root) newIndexSource(ctx context.Context, obj metadata.Object) *blockSource {
+	return &blockSource{root: r, obj: obj, ctx: ctx, idx: -1}
+}
+
+func (s *blockSource) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= s.obj.Size {
+			return n, io.EOF
+		}
+		idx := pos / s.root.block
+		if idx != s.idx {
+			ctx, cancel := context.WithTimeout(s.ctx, s.root.timeout)
+			fetch := s.root.readBlock
+			if s.cached {
+				fetch = s.root.fetchBlock
+			}
+			blk, err := fetch(ctx, s.obj, idx)
+			cancel()
+			if err != nil {
+				return n, err
+			}
+			s.dropLocked()
+			s.idx, s.last = idx, blk
+		}
+		shift := pos - idx*s.root.block
+		if shift >= int64(len(s.last.Data)) {
+			return n, io.ErrUnexpectedEOF
+		}
+		n += copy(p[n:], s.last.Data[shift:])
+	}
+	return n, nil
+}
+
+func (s *blockSource) dropLocked() {
+	if s.last != nil {
+		s.last.Release()
+		s.last, s.idx = nil, -1
+	}
+}
+
+func (s *blockSource) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropLocked()
+}
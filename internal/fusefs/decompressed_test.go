@@ -0,0 +1,31 @@
+package fusefs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestCompressedOnly(t *testing.T) {
+	page := func(ctx context.Context, cursor string, limit int) ([]fuse.DirEntry, string, error) {
+		return []fuse.DirEntry{
+			{Name: "app.log.gz", Mode: syscall.S_IFREG},
+			{Name: "logs", Mode: syscall.S_IFDIR},
+			{Name: "notes.txt", Mode: syscall.S_IFREG},
+			{Name: "dump.zst", Mode: syscall.S_IFREG},
+		}, "dump.zst", nil
+	}
+	entries, next, err := compressedOnly(page)(context.Background(), "", 4)
+	if err != nil || next != "dump.zst" {
+		t.Fatalf("next=%q err=%v", next, err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if len(names) != 3 || names[0] != "app.log" || names[1] != "logs" || names[2] != "dump" {
+		t.Fatalf("entries %v", names)
+	}
+}
@@ -0,0 +1,106 @@
+package fusefs
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// pageFunc returns up to limit entries after cursor and the cursor of the
+// following page, or "" once the directory is exhausted.
+type pageFunc func(ctx context.Context, cursor string, limit int) (entries []fuse.DirEntry, next string, err error)
+
+type dirListing struct {
+	entries []fuse.DirEntry
+	at      time.Time
+}
+
+// pagedStream pulls a directory from Postgres one keyset page at a time as
+// the kernel consumes it, stopping at the configured hard cap.
+type pagedStream struct {
+	fetch   pageFunc
+	page    int
+	max     int
+	timeout time.Duration
+	cursor  string
+	fetched int
+	buf     []fuse.DirEntry
+	all     []fuse.DirEntry
+	done    bool
+	errno   syscall.Errno
+	onDone  func([]fuse.DirEntry)
+}
+
+func (r *Root) listDir(key string, fetch pageFunc) fs.DirStream {
+	if l, ok := r.dirs.Get(key); ok && time.Since(l.at) < r.dirTTL {
+		return fs.NewListDirStream(l.entries)
+	}
+	dots := []fuse.DirEntry{{Name: ".", Mode: syscall.S_IFDIR}, {Name: "..", Mode: syscall.S_IFDIR}}
+	return &pagedStream{
+		fetch:   fetch,
+		page:    r.pageSize,
+		max:     r.maxEntries,
+		timeout: r.timeout,
+		buf:     dots,
+		all:     append([]fuse.DirEntry(nil), dots...),
+		onDone: func(entries []fuse.DirEntry) {
+			r.dirs.Set(key, dirListing{entries: entries, at: time.Now()})
+		},
+	}
+}
+
+func (s *pagedStream) HasNext() bool {
+	for len(s.buf) == 0 && !s.done {
+		s.fill()
+	}
+	return len(s.buf) > 0 || s.errno != 0
+}
+
+func (s *pagedStream) Next() (fuse.DirEntry, syscall.Errno) {
+	if s.errno != 0 {
+		errno := s.errno
+		s.errno = 0
+		return fuse.DirEntry{}, errno
+	}
+	e := s.buf[0]
+	s.buf = s.buf[1:]
+	return e, 0
+}
+
+func (s *pagedStream) Close() {}
+
+func (s *pagedStream) fill() {
+	limit := s.page
+	if rest := s.max - s.fetched; rest < limit {
+		limit = rest
+	}
+	if limit <= 0 {
+		s.finish()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	entries, next, err := s.fetch(ctx, s.cursor, limit)
+	if err != nil {
+		s.done = true
+		s.errno = syscall.EIO
+		return
+	}
+	s.buf = entries
+	s.all = append(s.all, entries...)
+	s.fetched += len(entries)
+	s.cursor = next
+	if next == "" {
+		s.finish()
+	}
+}
+
+func (s *pagedStream) finish() {
+	s.done = true
+	if s.onDone != nil {
+		s.onDone(s.all)
+	}
+}
@@ -0,0 +1,43 @@
+package fusefs
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestPagedStreamPagesAndCap(t *testing.T) {
+	calls := 0
+	fetch := func(ctx context.Context, cursor string, limit int) ([]fuse.DirEntry, string, error) {
+		calls++
+		start := 0
+		if cursor != "" {
+			start, _ = strconv.Atoi(cursor)
+		}
+		var out []fuse.DirEntry
+		for i := start; i < start+limit && i < 10; i++ {
+			out = append(out, fuse.DirEntry{Name: strconv.Itoa(i)})
+		}
+		if start+limit >= 10 {
+			return out, "", nil
+		}
+		return out, strconv.Itoa(start + limit), nil
+	}
+	var cached []fuse.DirEntry
+	s := &pagedStream{fetch: fetch, page: 3, max: 7, timeout: 1e9, onDone: func(e []fuse.DirEntry) { cached = e }}
+	n := 0
+	for s.HasNext() {
+		if _, errno := s.Next(); errno != 0 {
+			t.Fatalf("unexpected errno %d", errno)
+		}
+		n++
+	}
+	if n != 7 || calls != 3 {
+		t.Fatalf("want 7 entries in 3 pages, got %d in %d", n, calls)
+	}
+	if len(cached) != 7 {
+		t.Fatalf("unexpected cached listing %d", len(cached))
+	}
+}
@@ -2,9 +2,13 @@ package fusefs
 
 import (
 	"context"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/example/fuses3redispostgres/internal/cache"
+	"github.com/example/fuses3redispostgres/internal/config"
+	"github.com/example/fuses3redispostgres/internal/decompress"
 	"github.com/example/fuses3redispostgres/internal/metadata"
 	"github.com/example/fuses3redispostgres/internal/s3io"
 	"github.com/hanwen/go-fuse/v2/fs"
@@ -13,74 +17,110 @@ import (
 
 type Root struct {
 	fs.Inode
-	resolver *metadata.Resolver
-	reader   *s3io.Reader
-	block    int64
-	prefetch int64
-}
+	resolver   *metadata.Resolver
+	repo       *metadata.Repository
+	reader     *s3io.Reader
+	cache      *cache.Disk
+	block      int64
+	prefetch   int64
+	pageSize   int
+	maxEntries int
+	timeout    time.Duration
+	dirTTL     time.Duration
+	keepCache  bool
+	dirs       *cache.LRU[string, dirListing]
 
-func NewRoot(r *metadata.Resolver, reader *s3io.Reader, block, prefetch int64) *Root {
-	return &Root{resolver: r, reader: reader, block: block, prefetch: prefetch}
+	decompView    bool
+	decompSpacing int64
+	indexes       *cache.LRU[string, *decompress.Index]
+	indexTimeout  time.Duration
+	buildMu       sync.Mutex
+	builds        map[string]*indexBuild
 }
 
-func (r *Root) OnAdd(ctx context.Context) {
-	r.NewPersistentInode(ctx, &Dir{name: "files", root: r}, fs.StableAttr{Mode: syscall.S_IFDIR}, true)
-	r.NewPersistentInode(ctx, &Dir{name: "by-date", root: r}, fs.StableAttr{Mode: syscall.S_IFDIR}, true)
-}
-
-type Dir struct {
-	fs.Inode
-	name string
-	root *Root
-}
+func NewRoot(cfg config.App, r *metadata.Resolver, repo *metadata.Repository, reader *s3io.Reader, dc *cache.Disk) *Root {
+	block := cfg.BlockSizeBytes
+	if block <= 0 {
+		block = 8 << 20
+	}
+	pageSize := cfg.ReaddirPageSize
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	spacing := cfg.DecompressSpacing
+	if spacing <= 0 {
+		spacing = 16 << 20
+	}
+	indexTimeout := cfg.DecompressTimeout
+	if indexTimeout <= 0 {
+		indexTimeout = 10 * time.Minute
+	}
+	return &Root{
+		resolver: r, repo: repo, reader: reader, cache: dc, block: block, prefetch: cfg.PrefetchSizeByte,
+		pageSize: pageSize, maxEntries: cfg.ReaddirMaxEntries, timeout: timeout, dirTTL: cfg.ReaddirCacheTTL,
+		keepCache: cfg.FuseKeepCache,
+		dirs:      cache.NewLRU[string, dirListing](1024),
 
-func (d *Dir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
-	entries := []fuse.DirEntry{{Name: ".", Mode: syscall.S_IFDIR}, {Name: "..", Mode: syscall.S_IFDIR}, {Name: "README-LIMITED", Mode: syscall.S_IFREG}}
-	return fs.NewListDirStream(entries), 0
+		decompView: cfg.FuseDecompress, decompSpacing: spacing,
+		indexes: cache.NewLRU[string, *decompress.Index](64), indexTimeout: indexTimeout,
+		builds: map[string]*indexBuild{},
+	}
 }
 
-func (d *Dir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
-	if d.name == "files" {
-		obj, err := d.root.resolver.Resolve(ctx, metadata.JoinVirtualPath("/files", name))
-		if err != nil {
-			return nil, syscall.ENOENT
-		}
-		inode := d.NewPersistentInode(ctx, &File{obj: obj, root: d.root}, fs.StableAttr{Mode: syscall.S_IFREG})
-		out.SetAttrTimeout(2 * time.Second)
-		return inode, 0
+func (r *Root) OnAdd(ctx context.Context) {
+	r.AddChild("files", r.NewPersistentInode(ctx, &TreeDir{root: r, path: "/files"}, fs.StableAttr{Mode: syscall.S_IFDIR}), true)
+	r.AddChild("by-date", r.NewPersistentInode(ctx, &DateDir{root: r, level: levelRoot}, fs.StableAttr{Mode: syscall.S_IFDIR}), true)
+	r.AddChild("tree", r.NewPersistentInode(ctx, &TreeDir{root: r, path: "/"}, fs.StableAttr{Mode: syscall.S_IFDIR}), true)
+	if r.decompView {
+		r.AddChild("decompressed", r.NewPersistentInode(ctx, &DecompDir{root: r, path: "/"}, fs.StableAttr{Mode: syscall.S_IFDIR}), true)
 	}
-	return nil, syscall.ENOENT
 }
 
+// File is a regular file in the mount. resolve, when set, looks the object
+// up again on every open; versioned paths leave it nil.
 type File struct {
 	fs.Inode
-	obj  metadata.Object
-	root *Root
+	root    *Root
+	resolve func(context.Context) (metadata.Object, error)
+
+	mu     sync.Mutex
+	obj    metadata.Object
+	opened bool
 }
 
 func (f *File) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	out.Mode = syscall.S_IFREG | 0444
-	out.Size = uint64(f.obj.Size)
+	switch h := fh.(type) {
+	case *fileHandle:
+		return h.Getattr(ctx, out)
+	case *decompHandle:
+		fillDecompAttr(&out.Attr, h.obj, h.ix)
+		return 0
+	}
+	fillAttr(&out.Attr, f.snapshot())
 	return 0
 }
 
-func (f *File) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
-	return nil, fuse.FOPEN_DIRECT_IO, 0
+func fillAttr(out *fuse.Attr, obj metadata.Object) {
+	out.Mode = syscall.S_IFREG | 0444
+	out.Size = uint64(obj.LogicalSize())
+	out.SetTimes(nil, &obj.LastModified, nil)
 }
 
 func (f *File) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
-	start, end := s3io.AlignRange(off, int64(len(dest)), f.root.block, f.root.prefetch)
-	buf, err := f.root.reader.GetRange(ctx, f.obj.Bucket, f.obj.Key, start, end)
-	if err != nil {
-		return nil, syscall.EIO
-	}
-	shift := off - start
-	if shift >= int64(len(buf)) {
-		return fuse.ReadResultData(nil), 0
+	switch h := fh.(type) {
+	case *fileHandle:
+		return h.read(ctx, dest, off)
+	case *decompHandle:
+		return h.read(dest, off)
 	}
-	max := shift + int64(len(dest))
-	if max > int64(len(buf)) {
-		max = int64(len(buf))
+	h, errno := f.root.openHandle(ctx, f.snapshot())
+	if errno != 0 {
+		return nil, errno
 	}
-	return fuse.ReadResultData(buf[shift:max]), 0
+	defer h.Release(ctx)
+	return f.Read(ctx, h, dest, off)
 }
@@ -0,0 +1,68 @@
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/example/fuses3redispostgres/internal/s3io"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestOpenKeepCacheWhileETagUnchanged(t *testing.T) {
+	root := &Root{block: 1 << 20, timeout: time.Second, keepCache: true}
+	current := metadata.Object{VirtualPath: "/a", ETag: "v1", Size: 10}
+	f := &File{root: root, obj: current, resolve: func(context.Context) (metadata.Object, error) { return current, nil }}
+	ctx := context.Background()
+
+	fh, flags, errno := f.Open(ctx, 0)
+	if errno != 0 || flags&fuse.FOPEN_KEEP_CACHE != 0 {
+		t.Fatalf("first open: flags=%x errno=%v", flags, errno)
+	}
+	fh.(*fileHandle).Release(ctx)
+	if _, flags, _ = f.Open(ctx, 0); flags&fuse.FOPEN_KEEP_CACHE == 0 {
+		t.Fatalf("unchanged etag should keep cache, flags=%x", flags)
+	}
+
+	current = metadata.Object{VirtualPath: "/a", ETag: "v2", Size: 20}
+	fh, flags, _ = f.Open(ctx, 0)
+	if flags&fuse.FOPEN_KEEP_CACHE != 0 {
+		t.Fatal("changed etag must not keep cache")
+	}
+	if h := fh.(*fileHandle); h.obj.ETag != "v2" || h.obj.Size != 20 {
+		t.Fatalf("handle not pinned to new version: %+v", h.obj)
+	}
+
+	current = metadata.Object{VirtualPath: "/a", ETag: "v3"}
+	var out fuse.AttrOut
+	if f.Getattr(ctx, fh, &out); out.Size != 20 {
+		t.Fatalf("open handle should report its pinned size, got %d", out.Size)
+	}
+}
+
+func TestOpenDeletedObject(t *testing.T) {
+	f := &File{root: &Root{block: 1 << 20}, resolve: func(context.Context) (metadata.Object, error) { return metadata.Object{}, metadata.ErrNotFound }}
+	if _, _, errno := f.Open(context.Background(), 0); errno == 0 {
+		t.Fatal("expected ENOENT for a deleted object")
+	}
+}
+
+func TestReadErrno(t *testing.T) {
+	cases := []struct {
+		err  error
+		want syscall.Errno
+	}{
+		{fmt.Errorf("attempt: %w", context.DeadlineExceeded), syscall.ETIMEDOUT},
+		{fmt.Errorf("get: %w", s3io.ErrThrottled), syscall.EAGAIN},
+		{errors.New("connection reset"), syscall.EIO},
+	}
+	for _, c := range cases {
+		if got := readErrno(c.err); got != c.want {
+			t.Errorf("readErrno(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
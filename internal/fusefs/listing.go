@@ -0,0 +1,47 @@
+package fusefs
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+var maxDate = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+func (r *Root) listChildren(dir string) pageFunc {
+	return func(ctx context.Context, cursor string, limit int) ([]fuse.DirEntry, string, error) {
+		children, err := r.repo.ListChildren(ctx, dir, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		return dirEntries(children, limit)
+	}
+}
+
+func (r *Root) listPrefix(dir string, day time.Time) pageFunc {
+	return func(ctx context.Context, cursor string, limit int) ([]fuse.DirEntry, string, error) {
+		children, err := r.repo.ListPrefix(ctx, dir, day, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		return dirEntries(children, limit)
+	}
+}
+
+func dirEntries(children []metadata.DirEntry, limit int) ([]fuse.DirEntry, string, error) {
+	entries := make([]fuse.DirEntry, 0, len(children))
+	for _, c := range children {
+		mode := uint32(syscall.S_IFREG)
+		if c.IsDir {
+			mode = syscall.S_IFDIR
+		}
+		entries = append(entries, fuse.DirEntry{Name: c.Name, Mode: mode})
+	}
+	if len(children) < limit {
+		return entries, "", nil
+	}
+	return entries, children[len(children)-1].Name, nil
+}
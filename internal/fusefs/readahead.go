@@ -0,0 +1,154 @@
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/example/fuses3redispostgres/internal/s3io"
+)
+
+type blockFetch func(ctx context.Context, idx int64) (*s3io.Block, error)
+
+// inflight is one buffered or pending block. While it sits in the blocks map
+// it owns a reference to blk; once dropped, that reference is released as
+// soon as the fetch has finished.
+type inflight struct {
+	done    chan struct{}
+	blk     *s3io.Block
+	err     error
+	dropped bool
+}
+
+// readahead serves block reads for one open file. Once reads become
+// sequential it fetches the next blocks in the background, doubling the
+// window on every sequential read up to max blocks; a random read halves the
+// window and discards blocks that fall outside it.
+type readahead struct {
+	fetch  blockFetch
+	max    int
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	blocks map[int64]*inflight
+	next   int64
+	window int
+}
+
+func newReadahead(fetch blockFetch, max int) *readahead {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &readahead{fetch: fetch, max: max, ctx: ctx, cancel: cancel, blocks: map[int64]*inflight{}, next: -1}
+}
+
+// access records a read of [off, off+n) covering blocks first..last and
+// starts any read-ahead it warrants.
+func (r *readahead) access(off, n int64, first, last, lastBlock int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if off == r.next {
+		switch {
+		case r.window == 0:
+			r.window = 1
+		case r.window < r.max:
+			r.window *= 2
+		}
+		if r.window > r.max {
+			r.window = r.max
+		}
+	} else if r.next >= 0 {
+		r.window /= 2
+		for idx := range r.blocks {
+			if idx < first || idx > last+int64(r.window) {
+				r.dropLocked(idx)
+			}
+		}
+	}
+	r.next = off + n
+	for idx := range r.blocks {
+		if idx < first {
+			r.dropLocked(idx)
+		}
+	}
+	for idx := last + 1; idx <= last+int64(r.window) && idx <= lastBlock; idx++ {
+		if _, ok := r.blocks[idx]; !ok {
+			r.blocks[idx] = r.start(s3io.Speculative(r.ctx), idx)
+		}
+	}
+}
+
+// block returns block idx, sharing a fetch already under way. Blocks the
+// current read touches stay buffered so small sequential reads inside one
+// block do not refetch it. The caller releases the returned block.
+func (r *readahead) block(ctx context.Context, idx int64) (*s3io.Block, error) {
+	r.mu.Lock()
+	in, ok := r.blocks[idx]
+	if !ok {
+		in = r.start(r.ctx, idx)
+		r.blocks[idx] = in
+	}
+	r.mu.Unlock()
+	select {
+	case <-in.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	r.mu.Lock()
+	if in.blk != nil {
+		blk := in.blk.Retain()
+		r.mu.Unlock()
+		return blk, nil
+	}
+	if r.blocks[idx] == in {
+		delete(r.blocks, idx)
+	}
+	r.mu.Unlock()
+	// The fetch already spent its retries, so its error stands. Only a
+	// block dropped by a concurrent access, or a read-ahead skipped for
+	// lack of buffer memory, is fetched again.
+	if in.err != nil && !errors.Is(in.err, s3io.ErrBuffersFull) {
+		return nil, in.err
+	}
+	return r.fetch(ctx, idx)
+}
+
+func (r *readahead) start(ctx context.Context, idx int64) *inflight {
+	in := &inflight{done: make(chan struct{})}
+	go func() {
+		blk, err := r.fetch(ctx, idx)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if in.dropped && blk != nil {
+			blk.Release()
+			blk = nil
+		}
+		in.blk, in.err = blk, err
+		close(in.done)
+	}()
+	return in
+}
+
+// dropLocked removes block idx and gives up its reference.
+func (r *readahead) dropLocked(idx int64) {
+	in := r.blocks[idx]
+	delete(r.blocks, idx)
+	select {
+	case <-in.done:
+		if in.blk != nil {
+			in.blk.Release()
+			in.blk = nil
+		}
+	default:
+		in.dropped = true
+	}
+}
+
+// close stops background fetches and drops buffered blocks.
+func (r *readahead) close() {
+	r.cancel()
+	r.mu.Lock()
+	for idx := range r.blocks {
+		r.dropLocked(idx)
+	}
+	r.mu.Unlock()
+}
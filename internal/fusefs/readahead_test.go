@@ -0,0 +1,103 @@
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/s3io"
+)
+
+type countingFetch struct {
+	mu    sync.Mutex
+	calls map[int64]int
+}
+
+func (c *countingFetch) fetch(ctx context.Context, idx int64) (*s3io.Block, error) {
+	c.mu.Lock()
+	c.calls[idx]++
+	c.mu.Unlock()
+	return s3io.NewBlock([]byte{byte(idx)}), nil
+}
+
+func (c *countingFetch) fetched(idx int64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[idx]
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("blocks were not each fetched exactly once")
+}
+
+func TestReadaheadSequentialGrowsWindow(t *testing.T) {
+	f := &countingFetch{calls: map[int64]int{}}
+	r := newReadahead(f.fetch, 4)
+	defer r.close()
+	// One-byte blocks: every read is a whole block.
+	for off := int64(0); off < 4; off++ {
+		r.access(off, 1, off, off, 99)
+		blk, err := r.block(context.Background(), off)
+		if err != nil || blk.Data[0] != byte(off) {
+			t.Fatalf("block %d: %v %v", off, blk, err)
+		}
+		blk.Release()
+	}
+	if r.window != 4 {
+		t.Fatalf("window after sequential reads: %d", r.window)
+	}
+	waitFor(t, func() bool {
+		for idx := int64(0); idx <= 7; idx++ {
+			if f.fetched(idx) != 1 {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestReadaheadRandomShrinksWindow(t *testing.T) {
+	f := &countingFetch{calls: map[int64]int{}}
+	r := newReadahead(f.fetch, 8)
+	defer r.close()
+	for off := int64(0); off < 4; off++ {
+		r.access(off, 1, off, off, 99)
+	}
+	before := r.window
+	r.access(50, 1, 50, 50, 99)
+	if r.window != before/2 {
+		t.Fatalf("window %d after random read, want %d", r.window, before/2)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for idx := range r.blocks {
+		if idx < 50 {
+			t.Fatalf("block %d kept after random read", idx)
+		}
+	}
+}
+
+func TestReadaheadFailedFetchNotRepeated(t *testing.T) {
+	var calls atomic.Int32
+	boom := errors.New("boom")
+	ra := newReadahead(func(ctx context.Context, idx int64) (*s3io.Block, error) {
+		calls.Add(1)
+		return nil, boom
+	}, 4)
+	defer ra.close()
+	if _, err := ra.block(context.Background(), 0); !errors.Is(err, boom) {
+		t.Fatalf("got %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("failed block fetched %d times", n)
+	}
+}
@@ -0,0 +1,77 @@
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// TreeDir mirrors the virtual_path hierarchy, one inode per path component,
+// as recorded in the directories table.
+type TreeDir struct {
+	fs.Inode
+	root *Root
+	path string
+}
+
+func (d *TreeDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	return d.root.listDir("tree:"+d.path, d.root.listChildren(d.path)), 0
+}
+
+// Lookup prefers a directory over a file of the same name, as Readdir does.
+func (d *TreeDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	vp := metadata.JoinVirtualPath(d.path, name)
+	_, err := d.root.repo.StatDir(ctx, vp)
+	if err == nil {
+		return d.NewInode(ctx, &TreeDir{root: d.root, path: vp}, fs.StableAttr{Mode: syscall.S_IFDIR}), 0
+	}
+	if !errors.Is(err, metadata.ErrNotFound) {
+		return nil, syscall.EIO
+	}
+	obj, err := d.root.resolver.Resolve(ctx, vp)
+	if err == nil {
+		f := &File{obj: obj, root: d.root, resolve: func(ctx context.Context) (metadata.Object, error) { return d.root.resolver.Resolve(ctx, vp) }}
+		fillAttr(&out.Attr, obj)
+		out.SetAttrTimeout(2 * time.Second)
+		return d.NewInode(ctx, f, fs.StableAttr{Mode: syscall.S_IFREG}), 0
+	}
+	if !errors.Is(err, metadata.ErrNotFound) {
+		return nil, syscall.EIO
+	}
+	return d.lookupVersion(ctx, name, out)
+}
+
+// lookupVersion serves name@vN, the N-th recorded upload of name.
+func (d *TreeDir) lookupVersion(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	base, n, ok := splitVersion(name)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	obj, err := d.root.resolver.ResolveVersion(ctx, metadata.JoinVirtualPath(d.path, base), n)
+	if err != nil {
+		return nil, syscall.ENOENT
+	}
+	f := &File{obj: obj, root: d.root}
+	fillAttr(&out.Attr, obj)
+	out.SetAttrTimeout(time.Hour)
+	return d.NewInode(ctx, f, fs.StableAttr{Mode: syscall.S_IFREG}), 0
+}
+
+func splitVersion(name string) (string, int, bool) {
+	i := strings.LastIndex(name, "@v")
+	if i <= 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(name[i+2:])
+	if err != nil || n <= 0 || strconv.Itoa(n) != name[i+2:] {
+		return "", 0, false
+	}
+	return name[:i], n, true
+}
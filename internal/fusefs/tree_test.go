@@ -0,0 +1,14 @@
+package fusefs
+
+import "testing"
+
+func TestSplitVersion(t *testing.T) {
+	if base, n, ok := splitVersion("report.csv@v3"); !ok || base != "report.csv" || n != 3 {
+		t.Fatalf("unexpected split: %q %d %v", base, n, ok)
+	}
+	for _, name := range []string{"report.csv", "@v3", "a@v0", "a@v03", "a@vx"} {
+		if _, _, ok := splitVersion(name); ok {
+			t.Fatalf("expected %q to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// FindBySHA256 returns an active object with the given content, which lets an
+// upload point at an existing S3 object instead of storing another copy.
+// size is the logical size, so compressed and plain copies match.
+func (r *Repository) FindBySHA256(ctx context.Context, sha256Hex string, size int64) (Object, error) {
+	q := `SELECT ` + objectColumns + ` FROM objects
+	WHERE checksum_sha256=$1 AND COALESCE(original_size,size)=$2 AND status='active' ORDER BY id LIMIT 1`
+	obj, err := scanObject(r.pool.QueryRow(ctx, q, sha256Hex, size))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Object{}, ErrNotFound
+		}
+		return Object{}, fmt.Errorf("query by sha256: %w", err)
+	}
+	return obj, nil
+}
+
+// CountReferences returns how many rows that have not been purged still point
+// at the S3 object, so it is only deleted once nothing references it.
+func (r *Repository) CountReferences(ctx context.Context, bucket, key string, versionID *string) (int64, error) {
+	q := `SELECT count(*) FROM objects
+	WHERE bucket=$1 AND key=$2 AND COALESCE(version_id,'')=COALESCE($3,'') AND status<>'purged'`
+	var n int64
+	if err := r.pool.QueryRow(ctx, q, bucket, key, versionID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count references: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,54 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DecompressIndex is the stored seek index for one compressed object
+// version. An object can have one per codec, which names the layer it
+// indexes; Points is opaque to this package.
+type DecompressIndex struct {
+	Codec            string
+	DecompressedSize int64
+	Points           []byte
+}
+
+// GetDecompressIndex returns the codec index for the object content
+// identified by bucket, key and ETag, or ErrNotFound if none was built yet.
+func (r *Repository) GetDecompressIndex(ctx context.Context, bucket, key, etag, codec string) (DecompressIndex, error) {
+	q := `SELECT codec, decompressed_size, points FROM decompress_index WHERE bucket=$1 AND key=$2 AND etag=$3 AND codec=$4`
+	var ix DecompressIndex
+	if err := r.pool.QueryRow(ctx, q, bucket, key, etag, codec).Scan(&ix.Codec, &ix.DecompressedSize, &ix.Points); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return DecompressIndex{}, ErrNotFound
+		}
+		return DecompressIndex{}, fmt.Errorf("query decompress index: %w", err)
+	}
+	return ix, nil
+}
+
+// PutDecompressIndex stores an index; a concurrent build of the same object
+// content simply replaces it.
+func (r *Repository) PutDecompressIndex(ctx context.Context, bucket, key, etag string, ix DecompressIndex) error {
+	q := `INSERT INTO decompress_index (bucket, key, etag, codec, decompressed_size, points)
+	VALUES ($1,$2,$3,$4,$5,$6)
+	ON CONFLICT (bucket, key, etag, codec) DO UPDATE SET decompressed_size=EXCLUDED.decompressed_size, points=EXCLUDED.points, created_at=now()`
+	if _, err := r.pool.Exec(ctx, q, bucket, key, etag, ix.Codec, ix.DecompressedSize, ix.Points); err != nil {
+		return fmt.Errorf("insert decompress index: %w", err)
+	}
+	return nil
+}
+
+// DeleteDecompressIndex drops the codec index of the object content; an
+// empty codec drops all of them, once the content is gone.
+func (r *Repository) DeleteDecompressIndex(ctx context.Context, bucket, key, etag, codec string) error {
+	q := `DELETE FROM decompress_index WHERE bucket=$1 AND key=$2 AND etag=$3 AND ($4='' OR codec=$4)`
+	if _, err := r.pool.Exec(ctx, q, bucket, key, etag, codec); err != nil {
+		return fmt.Errorf("delete decompress index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Directory struct {
+	Path      string    `json:"path"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// liveDir keeps directories rows (aliased d) that still have an active object
+// below them. Rows are only ever added, so a directory whose objects were all
+// deleted, purged or moved stays in the table but is hidden.
+const liveDir = `EXISTS (SELECT 1 FROM objects o WHERE o.virtual_path COLLATE "C" > d.path || '/'
+	AND o.virtual_path COLLATE "C" < d.path || '0' AND o.status='active')`
+
+// ListChildren returns the subdirectories and files directly under dir whose
+// name sorts after cursor, in byte order, using the directories table and
+// objects.parent_path_hash instead of scanning paths. A file and a
+// subdirectory of the same name count once towards limit and are listed as the
+// directory, which is also what a lookup of the name finds.
+func (r *Repository) ListChildren(ctx context.Context, dir, cursor string, limit int) ([]DirEntry, error) {
+	q := `SELECT DISTINCT ON (name) name, is_dir FROM (
+		(SELECT d.name COLLATE "C" AS name, true AS is_dir FROM directories d
+		WHERE d.parent_path_hash=$1 AND d.name COLLATE "C" > $2 AND ` + liveDir + ` ORDER BY d.name COLLATE "C" LIMIT $3)
+		UNION ALL
+		(SELECT DISTINCT filename COLLATE "C", false FROM objects
+		WHERE parent_path_hash=$1 AND filename COLLATE "C" > $2 AND status='active' ORDER BY 1 LIMIT $3)
+	) c ORDER BY name, is_dir DESC LIMIT $3`
+	rows, err := r.pool.Query(ctx, q, hash(normalizeVirtualPath(dir)), cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query list children: %w", err)
+	}
+	defer rows.Close()
+	var out []DirEntry
+	for rows.Next() {
+		var e DirEntry
+		if err := rows.Scan(&e.Name, &e.IsDir); err != nil {
+			return nil, fmt.Errorf("scan list children: %w", err)
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate list children: %w", err)
+	}
+	return out, nil
+}
+
+// StatDir returns the directory at dir, or ErrNotFound when nothing active
+// lives below it any more. The root always exists.
+func (r *Repository) StatDir(ctx context.Context, dir string) (Directory, error) {
+	d := Directory{}
+	q := `SELECT path,name,created_at FROM directories d WHERE path_hash=$1 AND (path='/' OR ` + liveDir + `)`
+	err := r.pool.QueryRow(ctx, q, hash(normalizeVirtualPath(dir))).
+		Scan(&d.Path, &d.Name, &d.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Directory{}, ErrNotFound
+		}
+		return Directory{}, fmt.Errorf("query stat dir: %w", err)
+	}
+	return d, nil
+}
+
+func ensureDirectories(ctx context.Context, tx pgx.Tx, dir string) error {
+	var hashes, paths, parents, names []string
+	for _, p := range ancestors(dir) {
+		parent := ""
+		if p != "/" {
+			parent = hash(path.Dir(p))
+		}
+		hashes = append(hashes, hash(p))
+		paths = append(paths, p)
+		parents = append(parents, parent)
+		names = append(names, path.Base(p))
+	}
+	q := `INSERT INTO directories (path_hash,path,parent_path_hash,name)
+	SELECT h, p, NULLIF(pp, ''), CASE WHEN p = '/' THEN '' ELSE n END FROM unnest($1::text[], $2::text[], $3::text[], $4::text[]) AS t(h, p, pp, n)
+	ON CONFLICT (path_hash) DO NOTHING`
+	if _, err := tx.Exec(ctx, q, hashes, paths, parents, names); err != nil {
+		return fmt.Errorf("insert directories: %w", err)
+	}
+	return nil
+}
+
+// ancestors lists dir and every parent up to "/", root first.
+func ancestors(dir string) []string {
+	dir = normalizeVirtualPath(dir)
+	out := []string{dir}
+	for dir != "/" {
+		dir = path.Dir(dir)
+		out = append(out, dir)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
@@ -0,0 +1,201 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ListDates returns the distinct date_partition values truncated to unit
+// ("year", "month" or "day") in [from, to), walking the partition index with
+// one probe per value instead of scanning every row.
+func (r *Repository) ListDates(ctx context.Context, unit string, from, to time.Time, limit int) ([]time.Time, error) {
+	q := `WITH RECURSIVE d(v) AS (
+		SELECT (SELECT date_trunc($1, date_partition)::date FROM objects WHERE date_partition >= $2 AND date_partition < $3 AND status='active' ORDER BY date_partition LIMIT 1)
+		UNION ALL
+		SELECT (SELECT date_trunc($1, o.date_partition)::date FROM objects o WHERE o.date_partition >= (d.v + $4::interval)::date AND o.date_partition < $3 AND o.status='active' ORDER BY o.date_partition LIMIT 1)
+		FROM d WHERE d.v IS NOT NULL
+	)
+	SELECT v FROM d WHERE v IS NOT NULL LIMIT $5`
+	rows, err := r.pool.Query(ctx, q, unit, from, to, "1 "+unit, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query list dates: %w", err)
+	}
+	defer rows.Close()
+	var out []time.Time
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			return nil, fmt.Errorf("scan list dates: %w", err)
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate list dates: %w", err)
+	}
+	return out, nil
+}
+
+func dirPrefix(dir string) string {
+	dir = normalizeVirtualPath(dir)
+	if strings.HasSuffix(dir, "/") {
+		return dir
+	}
+	return dir + "/"
+}
+
+// prefixEnd is the smallest string greater than every path under prefix in
+// byte order: '0' directly follows '/'.
+func prefixEnd(prefix string) string {
+	return strings.TrimSuffix(prefix, "/") + "0"
+}
+
+type DirEntry struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir"`
+}
+
+// ListPrefix returns the distinct first path components below dir whose name
+// sorts after the keyset cursor. It skips over each subdirectory with one
+// index probe, so the cost follows the number of children rather than the
+// number of objects underneath. A non-zero day restricts it to that partition.
+// Each query walks at most limit+1 children; pageChildren decides which of
+// them are final, since a subdirectory "x" is walked after files such as
+// "x.txt" but sorts before them by name.
+func (r *Repository) ListPrefix(ctx context.Context, dir string, day time.Time, after string, limit int) ([]DirEntry, error) {
+	prefix := dirPrefix(dir)
+	return pagePrefix(prefix, after, limit, func(from string, n int) ([]string, error) {
+		return r.walkPrefix(ctx, prefix, from, day, n)
+	})
+}
+
+// walkPrefix returns up to n paths below prefix, starting at the first one at
+// or after from: one per child, the next probe starting at the subdirectory's
+// prefixEnd after a subdirectory (so a sibling named like "x0" next to "x/" is
+// not skipped) and just past the path after a file (chr(1) is the smallest
+// byte a path can continue with).
+func (r *Repository) walkPrefix(ctx context.Context, prefix, from string, day time.Time, n int) ([]string, error) {
+	args := []any{from, prefixEnd(prefix), len(prefix) + 1, n}
+	filter := ` AND status='active'`
+	if !day.IsZero() {
+		args = append(args, day)
+		filter += ` AND date_partition = $5`
+	}
+	q := `WITH RECURSIVE c(vp, n) AS (
+		(SELECT virtual_path COLLATE "C", 1 FROM objects WHERE virtual_path COLLATE "C" >= $1 AND virtual_path COLLATE "C" < $2` + filter + `
+		ORDER BY virtual_path COLLATE "C" LIMIT 1)
+		UNION ALL
+		SELECT (SELECT virtual_path COLLATE "C" FROM objects WHERE virtual_path COLLATE "C" >= (CASE WHEN strpos(substr(c.vp, $3), '/') > 0
+			THEN substr(c.vp, 1, $3 + strpos(substr(c.vp, $3), '/') - 2) || '0' ELSE c.vp || chr(1) END)
+			AND virtual_path COLLATE "C" < $2` + filter + ` ORDER BY virtual_path COLLATE "C" LIMIT 1), c.n + 1
+		FROM c WHERE c.vp IS NOT NULL AND c.n < $4
+	)
+	SELECT vp FROM c WHERE vp IS NOT NULL ORDER BY n`
+	rows, err := r.pool.Query(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query list prefix: %w", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var vp string
+		if err := rows.Scan(&vp); err != nil {
+			return nil, fmt.Errorf("scan list prefix: %w", err)
+		}
+		out = append(out, vp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate list prefix: %w", err)
+	}
+	return out, nil
+}
+
+// pagePrefix walks children of prefix in batches of limit+1 until a full page
+// of names after the cursor is final or the walk runs out.
+func pagePrefix(prefix, after string, limit int, walk func(from string, n int) ([]string, error)) ([]DirEntry, error) {
+	var walked []string
+	from := prefix + after + "\x01"
+	for {
+		batch, err := walk(from, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		for _, vp := range batch {
+			walked = append(walked, vp[len(prefix):])
+		}
+		done := len(batch) < limit+1
+		page := pageChildren(walked, after, done, limit)
+		if done || len(page) == limit {
+			return page, nil
+		}
+		last := walked[len(walked)-1]
+		if name, _, isDir := strings.Cut(last, "/"); isDir {
+			from = prefix + name + "0"
+		} else {
+			from = prefix + last + "\x01"
+		}
+	}
+}
+
+// pageChildren merges the walked relative paths into children, a file and a
+// subdirectory of the same name counting once as the directory, and returns
+// the first limit names after the cursor that no unwalked child can precede
+// or merge with. Unless done, a child still to be walked may be a
+// subdirectory named by any prefix of the last walked name that is followed
+// by a byte below '/', or, after a file, by that file's name.
+func pageChildren(walked []string, after string, done bool, limit int) []DirEntry {
+	isDir := map[string]bool{}
+	for _, rel := range walked {
+		name, _, dir := strings.Cut(rel, "/")
+		isDir[name] = isDir[name] || dir
+	}
+	bound, inclusive := "", true
+	if !done && len(walked) > 0 {
+		last, _, dir := strings.Cut(walked[len(walked)-1], "/")
+		bound, inclusive = last, dir
+		for i := 1; i < len(last); i++ {
+			if last[i] < '/' {
+				bound, inclusive = last[:i], false
+				break
+			}
+		}
+	}
+	names := make([]string, 0, len(isDir))
+	for name := range isDir {
+		if name <= after {
+			continue
+		}
+		if bound != "" && (name > bound || name == bound && !inclusive) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > limit {
+		names = names[:limit]
+	}
+	out := make([]DirEntry, len(names))
+	for i, name := range names {
+		out[i] = DirEntry{Name: name, IsDir: isDir[name]}
+	}
+	return out
+}
+
+// PrefixExists reports whether any object lives below dir, which is how a
+// virtual directory comes into existence.
+func (r *Repository) PrefixExists(ctx context.Context, dir string, day time.Time) (bool, error) {
+	prefix := dirPrefix(dir)
+	args := []any{prefix, prefixEnd(prefix)}
+	q := `SELECT EXISTS (SELECT 1 FROM objects WHERE virtual_path COLLATE "C" > $1 AND virtual_path COLLATE "C" < $2 AND status='active'`
+	if !day.IsZero() {
+		args = append(args, day)
+		q += ` AND date_partition = $3`
+	}
+	var ok bool
+	if err := r.pool.QueryRow(ctx, q+`)`, args...).Scan(&ok); err != nil {
+		return false, fmt.Errorf("query prefix exists: %w", err)
+	}
+	return ok, nil
+}
@@ -25,10 +25,36 @@ type Object struct {
 	VersionID    *string   `json:"version_id,omitempty"`
 	ChecksumMD5  *string   `json:"checksum_md5,omitempty"`
 	ChecksumSHA  *string   `json:"checksum_sha256,omitempty"`
+	Placement    string    `json:"placement_policy,omitempty"`
+	Codec        string    `json:"codec,omitempty"`
+	OriginalSize int64     `json:"original_size,omitempty"`
 }
 
+const (
+	StatusActive  = "active"
+	StatusDeleted = "deleted"
+	StatusPurged  = "purged"
+	StatusCorrupt = "corrupt"
+)
+
 var ErrNotFound = errors.New("object not found")
 
+// LogicalSize is the size of the content as uploaded. Size is what is
+// stored, which is smaller when the object was compressed on ingest.
+func (o Object) LogicalSize() int64 {
+	if o.Codec == "" {
+		return o.Size
+	}
+	return o.OriginalSize
+}
+
+func (o Object) Version() string {
+	if o.VersionID == nil {
+		return ""
+	}
+	return *o.VersionID
+}
+
 type Repository struct{ pool *pgxpool.Pool }
 
 func NewRepository(pool *pgxpool.Pool) *Repository { return &Repository{pool: pool} }
@@ -49,20 +75,27 @@ func normalizeVirtualPath(vpath string) string {
 	return clean
 }
 
+const objectColumns = `virtual_path,filename,bucket,key,size,etag,last_modified,COALESCE(storage_class,''),version_id,checksum_md5,checksum_sha256,COALESCE(placement_policy,''),COALESCE(codec,''),COALESCE(original_size,0)`
+
+// scanObject reads objectColumns followed by any extra selected columns.
+func scanObject(row pgx.Row, extra ...any) (Object, error) {
+	obj := Object{}
+	dest := append([]any{
+		&obj.VirtualPath, &obj.Filename, &obj.Bucket, &obj.Key, &obj.Size, &obj.ETag, &obj.LastModified,
+		&obj.StorageClass, &obj.VersionID, &obj.ChecksumMD5, &obj.ChecksumSHA, &obj.Placement,
+		&obj.Codec, &obj.OriginalSize,
+	}, extra...)
+	err := row.Scan(dest...)
+	return obj, err
+}
+
 func (r *Repository) ResolveByPath(ctx context.Context, vpath string) (Object, error) {
 	vp := normalizeVirtualPath(vpath)
 	filename := path.Base(vp)
-	q := `SELECT virtual_path,filename,bucket,key,size,etag,last_modified,storage_class,version_id,checksum_md5,checksum_sha256
-	FROM objects WHERE path_hash=$1 AND filename_hash=$2 ORDER BY date_partition DESC LIMIT 1`
-	obj := Object{}
-	err := r.pool.QueryRow(ctx, q, hash(vp), hash(filename)).Scan(
-		&obj.VirtualPath, &obj.Filename, &obj.Bucket, &obj.Key, &obj.Size, &obj.ETag, &obj.LastModified,
-		&obj.StorageClass, &obj.VersionID, &obj.ChecksumMD5, &obj.ChecksumSHA,
-	)
+	q := `SELECT ` + objectColumns + `
+	FROM objects WHERE path_hash=$1 AND filename_hash=$2 AND status='active' ORDER BY date_partition DESC, id DESC LIMIT 1`
+	obj, err := scanObject(r.pool.QueryRow(ctx, q, hash(vp), hash(filename)))
 	if err != nil {
-		if errors.Is(err, pgxpool.ErrClosed) {
-			return Object{}, fmt.Errorf("pool closed: %w", err)
-		}
 		if errors.Is(err, pgx.ErrNoRows) {
 			return Object{}, ErrNotFound
 		}
@@ -71,18 +104,43 @@ func (r *Repository) ResolveByPath(ctx context.Context, vpath string) (Object, e
 	return obj, nil
 }
 
-func (r *Repository) UpsertObject(ctx context.Context, obj Object, datePartition time.Time, status string) error {
+func (r *Repository) ResolveOnDate(ctx context.Context, vpath string, day time.Time) (Object, error) {
+	vp := normalizeVirtualPath(vpath)
+	q := `SELECT ` + objectColumns + `
+	FROM objects WHERE path_hash=$1 AND filename_hash=$2 AND date_partition=$3 AND status='active' ORDER BY id DESC LIMIT 1`
+	obj, err := scanObject(r.pool.QueryRow(ctx, q, hash(vp), hash(path.Base(vp)), day))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Object{}, ErrNotFound
+		}
+		return Object{}, fmt.Errorf("query resolve on date: %w", err)
+	}
+	return obj, nil
+}
+
+// InsertObject records a new version of obj. Earlier rows for the same path
+// are kept so their history stays readable.
+func (r *Repository) InsertObject(ctx context.Context, obj Object, datePartition time.Time, status string) error {
 	obj.VirtualPath = normalizeVirtualPath(obj.VirtualPath)
 	obj.Filename = path.Base(obj.VirtualPath)
+	parent := path.Dir(obj.VirtualPath)
 	q := `INSERT INTO objects
-	(date_partition,virtual_path,path_hash,filename,filename_hash,bucket,key,size,etag,last_modified,checksum_md5,checksum_sha256,status)
-	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
-	ON CONFLICT (date_partition,path_hash,filename_hash)
-	DO UPDATE SET bucket=EXCLUDED.bucket,key=EXCLUDED.key,size=EXCLUDED.size,etag=EXCLUDED.etag,
-	last_modified=EXCLUDED.last_modified,checksum_md5=EXCLUDED.checksum_md5,checksum_sha256=EXCLUDED.checksum_sha256,status=EXCLUDED.status,verified_at=NOW()`
-	_, err := r.pool.Exec(ctx, q, datePartition, obj.VirtualPath, hash(obj.VirtualPath), obj.Filename, hash(obj.Filename), obj.Bucket, obj.Key, obj.Size, obj.ETag, obj.LastModified, obj.ChecksumMD5, obj.ChecksumSHA, status)
+	(date_partition,virtual_path,path_hash,filename,filename_hash,bucket,key,size,etag,last_modified,version_id,checksum_md5,checksum_sha256,status,parent_path_hash,placement_policy,codec,original_size)
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,NULLIF($16,''),NULLIF($17,''),CASE WHEN $17::text = '' THEN NULL ELSE $18::bigint END)`
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("upsert object: %w", err)
+		return fmt.Errorf("begin insert: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := ensureDirectories(ctx, tx, parent); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, q, datePartition, obj.VirtualPath, hash(obj.VirtualPath), obj.Filename, hash(obj.Filename), obj.Bucket, obj.Key, obj.Size, obj.ETag, obj.LastModified, obj.VersionID, obj.ChecksumMD5, obj.ChecksumSHA, status, hash(parent), obj.Placement, obj.Codec, obj.OriginalSize)
+	if err != nil {
+		return fmt.Errorf("insert object: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit insert: %w", err)
 	}
 	return nil
 }
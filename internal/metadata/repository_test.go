@@ -1,6 +1,10 @@
 package metadata
 
-import "testing"
+import (
+	"sort"
+	"strings"
+	"testing"
+)
 
 func TestNormalizeVirtualPath(t *testing.T) {
 	got := normalizeVirtualPath("20200101/2014/a.pdf")
@@ -15,3 +19,85 @@ func TestJoinVirtualPath(t *testing.T) {
 		t.Fatalf("unexpected joined path: %s", got)
 	}
 }
+
+func TestDirPrefixBounds(t *testing.T) {
+	if got := dirPrefix("files"); got != "/files/" {
+		t.Fatalf("unexpected prefix: %s", got)
+	}
+	if got := dirPrefix("/"); got != "/" {
+		t.Fatalf("unexpected root prefix: %s", got)
+	}
+	if got := prefixEnd("/files/"); got != "/files0" {
+		t.Fatalf("unexpected prefix end: %s", got)
+	}
+}
+
+func TestAncestors(t *testing.T) {
+	got := ancestors("/20200101/2014")
+	want := []string{"/", "/20200101", "/20200101/2014"}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected ancestors: %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected ancestors: %v", got)
+		}
+	}
+}
+
+// memWalk mimics walkPrefix over an in-memory set of paths.
+func memWalk(paths []string, prefix string) func(from string, n int) ([]string, error) {
+	sort.Strings(paths)
+	return func(from string, n int) ([]string, error) {
+		var out []string
+		for len(out) < n {
+			i := sort.SearchStrings(paths, from)
+			if i == len(paths) || paths[i] >= prefixEnd(prefix) {
+				break
+			}
+			vp := paths[i]
+			out = append(out, vp)
+			if name, _, dir := strings.Cut(vp[len(prefix):], "/"); dir {
+				from = prefix + name + "0"
+			} else {
+				from = vp + "\x01"
+			}
+		}
+		return out, nil
+	}
+}
+
+func TestPagePrefix(t *testing.T) {
+	paths := []string{
+		"/d/dir/a", "/d/dir/b", "/d/dir0", "/d/dir", "/d/dir.txt", "/d/dir-1/x",
+		"/d/a", "/d/b/c", "/d/x.1", "/d/x.2", "/d/x.3", "/d/x/y", "/d/z",
+	}
+	want := []string{"a", "b/", "dir/", "dir-1/", "dir.txt", "dir0", "x/", "x.1", "x.2", "x.3", "z"}
+	for limit := 1; limit <= len(want)+1; limit++ {
+		var got []string
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > len(want)+1 {
+				t.Fatalf("limit %d: listing does not end", limit)
+			}
+			page, err := pagePrefix("/d/", cursor, limit, memWalk(paths, "/d/"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range page {
+				name := e.Name
+				if e.IsDir {
+					name += "/"
+				}
+				got = append(got, name)
+			}
+			if len(page) < limit {
+				break
+			}
+			cursor = page[len(page)-1].Name
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Fatalf("limit %d: got %v, want %v", limit, got, want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/example/fuses3redispostgres/internal/cache"
@@ -24,22 +25,34 @@ func NewResolver(repo *Repository, redis *redis.Client, cap int, ttl time.Durati
 
 func (r *Resolver) Resolve(ctx context.Context, virtualPath string) (Object, error) {
 	vp := normalizeVirtualPath(virtualPath)
-	if obj, ok := r.lru.Get(vp); ok {
+	return r.cached(ctx, pathKey(vp), func() (Object, error) { return r.repo.ResolveByPath(ctx, vp) })
+}
+
+func (r *Resolver) ResolveOnDate(ctx context.Context, virtualPath string, day time.Time) (Object, error) {
+	vp := normalizeVirtualPath(virtualPath)
+	return r.cached(ctx, dateKey(vp, day), func() (Object, error) { return r.repo.ResolveOnDate(ctx, vp, day) })
+}
+
+func (r *Resolver) ResolveVersion(ctx context.Context, virtualPath string, n int) (Object, error) {
+	return r.repo.ResolveVersion(ctx, virtualPath, n)
+}
+
+func (r *Resolver) cached(ctx context.Context, key string, load func() (Object, error)) (Object, error) {
+	if obj, ok := r.lru.Get(key); ok {
 		return obj, nil
 	}
-	key := "resolve:path:" + vp
 	if raw, err := r.redis.Get(ctx, key).Result(); err == nil {
 		var obj Object
 		if uerr := json.Unmarshal([]byte(raw), &obj); uerr == nil {
-			r.lru.Set(vp, obj)
+			r.lru.Set(key, obj)
 			return obj, nil
 		}
 	}
-	obj, err := r.repo.ResolveByPath(ctx, vp)
+	obj, err := load()
 	if err != nil {
 		return Object{}, err
 	}
-	r.lru.Set(vp, obj)
+	r.lru.Set(key, obj)
 	b, _ := json.Marshal(obj)
 	if err := r.redis.Set(ctx, key, b, r.ttl).Err(); err != nil {
 		return obj, fmt.Errorf("set redis cache: %w", err)
@@ -47,6 +60,60 @@ func (r *Resolver) Resolve(ctx context.Context, virtualPath string) (Object, err
 	return obj, nil
 }
 
+const invalidateChannel = "object_invalidated"
+
+// Invalidate drops the cached resolutions of vpath (including the by-date
+// ones for days) from Redis and the local LRU, and tells other processes to
+// drop theirs through Watch.
+func (r *Resolver) Invalidate(ctx context.Context, vpath string, days []time.Time) error {
+	keys := cacheKeys(normalizeVirtualPath(vpath), days)
+	for _, k := range keys {
+		r.lru.Delete(k)
+	}
+	if err := r.redis.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("delete redis cache: %w", err)
+	}
+	if err := r.redis.Publish(ctx, invalidateChannel, strings.Join(keys, "\n")).Err(); err != nil {
+		return fmt.Errorf("publish invalidation: %w", err)
+	}
+	return nil
+}
+
+// Watch applies invalidations published by other processes to the local LRU
+// until ctx is done.
+func (r *Resolver) Watch(ctx context.Context) {
+	sub := r.redis.Subscribe(ctx, invalidateChannel)
+	defer sub.Close()
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			for _, k := range strings.Split(msg.Payload, "\n") {
+				r.lru.Delete(k)
+			}
+		}
+	}
+}
+
+func cacheKeys(vp string, days []time.Time) []string {
+	keys := []string{pathKey(vp)}
+	for _, d := range days {
+		keys = append(keys, dateKey(vp, d))
+	}
+	return keys
+}
+
+func pathKey(vp string) string { return "resolve:path:" + vp }
+
+func dateKey(vp string, day time.Time) string {
+	return "resolve:date:" + day.Format("2006-01-02") + ":" + vp
+}
+
 func JoinVirtualPath(baseDir, name string) string {
 	return normalizeVirtualPath(path.Join(baseDir, name))
 }
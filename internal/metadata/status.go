@@ -0,0 +1,79 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+)
+
+type PurgeCandidate struct {
+	ID            int64
+	DatePartition time.Time
+	VirtualPath   string
+	Bucket        string
+	Key           string
+	VersionID     *string
+	ETag          string
+}
+
+// SetStatus moves every row of vpath from one status to another and returns
+// the date partitions it touched, or ErrNotFound if none matched.
+func (r *Repository) SetStatus(ctx context.Context, vpath, from, to string) ([]time.Time, error) {
+	vp := normalizeVirtualPath(vpath)
+	q := `UPDATE objects SET status=$4, status_changed_at=NOW()
+	WHERE path_hash=$1 AND filename_hash=$2 AND status=$3 RETURNING date_partition`
+	rows, err := r.pool.Query(ctx, q, hash(vp), hash(path.Base(vp)), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("update status: %w", err)
+	}
+	defer rows.Close()
+	var days []time.Time
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			return nil, fmt.Errorf("scan status: %w", err)
+		}
+		days = append(days, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate status: %w", err)
+	}
+	if len(days) == 0 {
+		return nil, ErrNotFound
+	}
+	return days, nil
+}
+
+func (r *Repository) ListPurgeable(ctx context.Context, deletedBefore time.Time, limit int) ([]PurgeCandidate, error) {
+	q := `SELECT id,date_partition,virtual_path,bucket,key,version_id,etag FROM objects
+	WHERE status='deleted' AND status_changed_at < $1 ORDER BY status_changed_at LIMIT $2`
+	rows, err := r.pool.Query(ctx, q, deletedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query purgeable: %w", err)
+	}
+	defer rows.Close()
+	var out []PurgeCandidate
+	for rows.Next() {
+		var c PurgeCandidate
+		if err := rows.Scan(&c.ID, &c.DatePartition, &c.VirtualPath, &c.Bucket, &c.Key, &c.VersionID, &c.ETag); err != nil {
+			return nil, fmt.Errorf("scan purgeable: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate purgeable: %w", err)
+	}
+	return out, nil
+}
+
+// TransitionRow moves a single row between statuses and reports whether it
+// was still in the expected one, so a restore that races the purge job wins.
+func (r *Repository) TransitionRow(ctx context.Context, id int64, datePartition time.Time, from, to string) (bool, error) {
+	q := `UPDATE objects SET status=$4, status_changed_at=NOW() WHERE id=$1 AND date_partition=$2 AND status=$3`
+	tag, err := r.pool.Exec(ctx, q, id, datePartition, from, to)
+	if err != nil {
+		return false, fmt.Errorf("transition row: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,73 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// VerifyCandidate is an active object with a recorded SHA-256 that has not
+// been verified since a given time.
+type VerifyCandidate struct {
+	Object
+	ID            int64
+	DatePartition time.Time
+	VerifiedAt    *time.Time
+}
+
+// ListUnverified returns active objects never verified or last verified
+// before the cutoff, oldest verification first. With after set it continues
+// behind that candidate, so rows a pass could not check are not selected
+// again in the same pass.
+func (r *Repository) ListUnverified(ctx context.Context, verifiedBefore time.Time, after *VerifyCandidate, limit int) ([]VerifyCandidate, error) {
+	q := `SELECT ` + objectColumns + `,id,date_partition,verified_at FROM objects
+	WHERE status='active' AND checksum_sha256 IS NOT NULL AND (verified_at IS NULL OR verified_at < $1)
+	AND ($3::bigint IS NULL OR (COALESCE(verified_at,'-infinity'),date_partition,id) > (COALESCE($4::timestamptz,'-infinity'),$5::date,$3))
+	ORDER BY verified_at NULLS FIRST, date_partition, id LIMIT $2`
+	var id *int64
+	var verifiedAt *time.Time
+	var day time.Time
+	if after != nil {
+		id, verifiedAt, day = &after.ID, after.VerifiedAt, after.DatePartition
+	}
+	rows, err := r.pool.Query(ctx, q, verifiedBefore, limit, id, verifiedAt, day)
+	if err != nil {
+		return nil, fmt.Errorf("query unverified: %w", err)
+	}
+	defer rows.Close()
+	var out []VerifyCandidate
+	for rows.Next() {
+		var c VerifyCandidate
+		obj, err := scanObject(rows, &c.ID, &c.DatePartition, &c.VerifiedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan unverified: %w", err)
+		}
+		c.Object = obj
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate unverified: %w", err)
+	}
+	return out, nil
+}
+
+// MarkVerified records a successful integrity check.
+func (r *Repository) MarkVerified(ctx context.Context, id int64, datePartition time.Time) error {
+	q := `UPDATE objects SET verified_at=NOW() WHERE id=$1 AND date_partition=$2`
+	if _, err := r.pool.Exec(ctx, q, id, datePartition); err != nil {
+		return fmt.Errorf("mark verified: %w", err)
+	}
+	return nil
+}
+
+// MarkCorrupt takes an active row out of service after a failed integrity
+// check. It reports whether the row was still active.
+func (r *Repository) MarkCorrupt(ctx context.Context, id int64, datePartition time.Time) (bool, error) {
+	q := `UPDATE objects SET status='corrupt', status_changed_at=NOW(), verified_at=NOW()
+	WHERE id=$1 AND date_partition=$2 AND status='active'`
+	tag, err := r.pool.Exec(ctx, q, id, datePartition)
+	if err != nil {
+		return false, fmt.Errorf("mark corrupt: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
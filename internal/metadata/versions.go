@@ -0,0 +1,64 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Version struct {
+	Object
+	Number        int       `json:"version"`
+	DatePartition time.Time `json:"date_partition"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ListVersions returns every upload recorded for vpath, oldest first and
+// numbered from 1.
+func (r *Repository) ListVersions(ctx context.Context, vpath string) ([]Version, error) {
+	vp := normalizeVirtualPath(vpath)
+	q := `SELECT ` + objectColumns + `,row_number() OVER (ORDER BY id),date_partition,status,created_at
+	FROM objects WHERE path_hash=$1 AND filename_hash=$2 ORDER BY id`
+	rows, err := r.pool.Query(ctx, q, hash(vp), hash(path.Base(vp)))
+	if err != nil {
+		return nil, fmt.Errorf("query versions: %w", err)
+	}
+	defer rows.Close()
+	var out []Version
+	for rows.Next() {
+		var v Version
+		var n int64
+		obj, err := scanObject(rows, &n, &v.DatePartition, &v.Status, &v.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan versions: %w", err)
+		}
+		v.Object, v.Number = obj, int(n)
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate versions: %w", err)
+	}
+	return out, nil
+}
+
+// ResolveVersion returns version n (1-based, as numbered by ListVersions) of
+// vpath while it is active.
+func (r *Repository) ResolveVersion(ctx context.Context, vpath string, n int) (Object, error) {
+	vp := normalizeVirtualPath(vpath)
+	q := `SELECT ` + objectColumns + ` FROM (
+		SELECT *, row_number() OVER (ORDER BY id) AS n FROM objects WHERE path_hash=$1 AND filename_hash=$2
+	) v WHERE n=$3 AND status='active'`
+	obj, err := scanObject(r.pool.QueryRow(ctx, q, hash(vp), hash(path.Base(vp)), n))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Object{}, ErrNotFound
+		}
+		return Object{}, fmt.Errorf("query resolve version: %w", err)
+	}
+	return obj, nil
+}
@@ -0,0 +1,210 @@
+package placement
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/config"
+)
+
+const (
+	ModeTemplate = "template"
+	ModeSingle   = "single"
+	ModeTenant   = "tenant"
+	ModeHash     = "hash"
+)
+
+const (
+	defaultBucket = "data-{year}"
+	defaultKey    = "{year}/{month}/{day}/{shard}/{upload}/{filename}"
+)
+
+var (
+	ErrTenantRequired = errors.New("tenant required")
+
+	tenantRE = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+	bucketRE = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+)
+
+// Request describes an upload to place. Upload is unique per upload so a
+// re-upload of the same path never overwrites the object an earlier version
+// row points at.
+type Request struct {
+	Date        time.Time
+	VirtualPath string
+	Filename    string
+	Tenant      string
+	Upload      string
+}
+
+// Placement decides the bucket and key of an upload. Version identifies the
+// policy and its settings. Compression names the codec uploads are stored
+// with, or "" to store them as received. VersionFor is what is recorded with
+// an object the policy placed and that was stored with codec, which differs
+// from Version when an upload overrides the compression or is multipart.
+type Placement interface {
+	Place(Request) (bucket, key string, err error)
+	Version() string
+	VersionFor(codec string) string
+	Compression() string
+}
+
+// Template expands bucket and key templates. Supported tokens are {year},
+// {month}, {day}, {date}, {filename}, {path}, {tenant}, {upload} and {shard},
+// which is ShardDepth groups of ShardChars hex digits of SHA-256(filename).
+// The key template must contain {upload}.
+type Template struct {
+	Bucket     string
+	Key        string
+	ShardChars int
+	ShardDepth int
+	Compress   string
+	mode       string
+	version    string
+	pinned     bool
+}
+
+// New builds the policy selected by PLACEMENT_MODE. Unset templates fall back
+// to the mode's defaults; the template defaults keep the original data-<year>
+// buckets and YYYY/MM/DD/<sha4>/ prefixes, followed by <upload>/<filename>.
+func New(cfg config.App) (Placement, error) {
+	t := &Template{Bucket: cfg.PlacementBucket, Key: cfg.PlacementKey, ShardChars: cfg.PlacementShardChars, ShardDepth: cfg.PlacementShardDepth, Compress: cfg.PlacementCompress}
+	mode := cfg.PlacementMode
+	if mode == "" {
+		mode = ModeTemplate
+	}
+	switch mode {
+	case ModeTemplate:
+		t.Bucket = orDefault(t.Bucket, defaultBucket)
+		t.Key = orDefault(t.Key, defaultKey)
+	case ModeSingle:
+		if t.Bucket == "" || strings.Contains(t.Bucket, "{") {
+			return nil, errors.New("single placement needs a fixed PLACEMENT_BUCKET")
+		}
+		t.Key = orDefault(t.Key, defaultKey)
+	case ModeTenant:
+		t.Bucket = orDefault(t.Bucket, "{tenant}-"+defaultBucket)
+		if !strings.Contains(t.Bucket, "{tenant}") {
+			return nil, errors.New("tenant placement needs {tenant} in PLACEMENT_BUCKET")
+		}
+		t.Key = orDefault(t.Key, defaultKey)
+	case ModeHash:
+		t.Bucket = orDefault(t.Bucket, defaultBucket)
+		t.Key = orDefault(t.Key, "{shard}/{year}/{month}/{day}/{upload}/{filename}")
+		if t.ShardDepth <= 0 {
+			t.ShardDepth = 2
+		}
+		if t.ShardChars <= 0 {
+			t.ShardChars = 2
+		}
+	default:
+		return nil, fmt.Errorf("unknown placement mode %q", mode)
+	}
+	if t.ShardChars <= 0 {
+		t.ShardChars = 4
+	}
+	if t.ShardDepth <= 0 {
+		t.ShardDepth = 1
+	}
+	if !strings.Contains(t.Key, "{upload}") {
+		return nil, errors.New("PLACEMENT_KEY needs {upload} so re-uploads of a path do not overwrite earlier versions")
+	}
+	if t.ShardChars*t.ShardDepth > 64 {
+		return nil, errors.New("shard longer than a SHA-256 digest")
+	}
+	switch t.Compress {
+	case "none":
+		t.Compress = ""
+	case "", "zstd":
+	default:
+		return nil, fmt.Errorf("unknown PLACEMENT_COMPRESS %q", t.Compress)
+	}
+	t.mode, t.version, t.pinned = mode, cfg.PlacementVersion, cfg.PlacementVersion != ""
+	if !t.pinned {
+		t.version = t.settingsVersion(t.Compress)
+	}
+	return t, nil
+}
+
+// settingsVersion hashes the settings as if the policy stored uploads with
+// codec.
+func (t *Template) settingsVersion(codec string) string {
+	settings := fmt.Sprintf("%s|%s|%d|%d", t.Bucket, t.Key, t.ShardChars, t.ShardDepth)
+	if codec != "" {
+		settings += "|" + codec
+	}
+	sum := sha256.Sum256([]byte(settings))
+	return t.mode + "-" + hex.EncodeToString(sum[:4])
+}
+
+func (t *Template) Place(r Request) (string, string, error) {
+	if strings.Contains(t.Bucket+t.Key, "{tenant}") {
+		if r.Tenant == "" {
+			return "", "", ErrTenantRequired
+		}
+		if !tenantRE.MatchString(r.Tenant) {
+			return "", "", fmt.Errorf("invalid tenant %q", r.Tenant)
+		}
+	}
+	bucket := t.expand(t.Bucket, r)
+	if !bucketRE.MatchString(bucket) {
+		return "", "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	if r.Upload == "" {
+		return "", "", errors.New("upload id required")
+	}
+	key := strings.TrimPrefix(t.expand(t.Key, r), "/")
+	if key == "" {
+		return "", "", errors.New("empty key")
+	}
+	return bucket, key, nil
+}
+
+func (t *Template) Version() string { return t.version }
+
+// VersionFor hashes the settings with codec in place of Compress. A
+// PLACEMENT_VERSION set by the operator is recorded as is.
+func (t *Template) VersionFor(codec string) string {
+	if t.pinned || codec == t.Compress {
+		return t.version
+	}
+	return t.settingsVersion(codec)
+}
+
+func (t *Template) Compression() string { return t.Compress }
+
+func (t *Template) expand(tmpl string, r Request) string {
+	return strings.NewReplacer(
+		"{year}", r.Date.Format("2006"),
+		"{month}", r.Date.Format("01"),
+		"{day}", r.Date.Format("02"),
+		"{date}", r.Date.Format("2006-01-02"),
+		"{filename}", r.Filename,
+		"{path}", strings.TrimPrefix(r.VirtualPath, "/"),
+		"{tenant}", r.Tenant,
+		"{upload}", r.Upload,
+		"{shard}", t.shard(r.Filename),
+	).Replace(tmpl)
+}
+
+func (t *Template) shard(filename string) string {
+	sum := sha256.Sum256([]byte(filename))
+	digest := hex.EncodeToString(sum[:])
+	parts := make([]string, t.ShardDepth)
+	for i := range parts {
+		parts[i] = digest[i*t.ShardChars : (i+1)*t.ShardChars]
+	}
+	return strings.Join(parts, "/")
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
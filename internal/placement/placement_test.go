@@ -0,0 +1,107 @@
+package placement
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/config"
+)
+
+func TestTemplateDefaultLayout(t *testing.T) {
+	p, err := New(config.App{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	bucket, key, err := p.Place(Request{Date: day, VirtualPath: "/files/a.txt", Filename: "a.txt", Upload: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket != "data-2024" || !strings.HasPrefix(key, "2024/01/02/") || !strings.HasSuffix(key, "/u1/a.txt") || len(strings.Split(key, "/")[3]) != 4 {
+		t.Fatalf("placed at %s/%s", bucket, key)
+	}
+	if !strings.HasPrefix(p.Version(), "template-") {
+		t.Fatalf("version: %s", p.Version())
+	}
+}
+
+func TestModes(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	req := Request{Date: day, VirtualPath: "/x/a.txt", Filename: "a.txt", Tenant: "acme", Upload: "u1"}
+
+	single, err := New(config.App{PlacementMode: ModeSingle, PlacementBucket: "staging"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _, err := single.Place(req); err != nil || b != "staging" {
+		t.Fatalf("single: %s %v", b, err)
+	}
+	if _, err := New(config.App{PlacementMode: ModeSingle}); err == nil {
+		t.Fatal("single without bucket should fail")
+	}
+
+	tenant, err := New(config.App{PlacementMode: ModeTenant})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _, err := tenant.Place(req); err != nil || b != "acme-data-2024" {
+		t.Fatalf("tenant: %s %v", b, err)
+	}
+	if _, _, err := tenant.Place(Request{Date: day, Filename: "a.txt"}); !errors.Is(err, ErrTenantRequired) {
+		t.Fatalf("missing tenant: %v", err)
+	}
+
+	hashed, err := New(config.App{PlacementMode: ModeHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, key, err := hashed.Place(req)
+	parts := strings.Split(key, "/")
+	if err != nil || len(parts) != 7 || len(parts[0]) != 2 || len(parts[1]) != 2 || parts[2] != "2024" {
+		t.Fatalf("hash: %s %v", key, err)
+	}
+	if hashed.Version() == tenant.Version() {
+		t.Fatal("policies should have distinct versions")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	plain, _ := New(config.App{})
+	none, err := New(config.App{PlacementCompress: "none"})
+	if err != nil || none.Compression() != "" || none.Version() != plain.Version() {
+		t.Fatalf("none: %v %q", err, none.Version())
+	}
+	zstd, err := New(config.App{PlacementCompress: "zstd"})
+	if err != nil || zstd.Compression() != "zstd" {
+		t.Fatalf("zstd: %v", err)
+	}
+	if zstd.Version() == plain.Version() {
+		t.Fatal("compression should change the version")
+	}
+	if zstd.VersionFor("") != plain.Version() || plain.VersionFor("zstd") != zstd.Version() || zstd.VersionFor("zstd") != zstd.Version() {
+		t.Fatal("VersionFor should match the policy with that compression")
+	}
+	if _, err := New(config.App{PlacementCompress: "lz4"}); err == nil {
+		t.Fatal("unknown codec should fail")
+	}
+}
+
+func TestKeysAreUniquePerUpload(t *testing.T) {
+	if _, err := New(config.App{PlacementKey: "{date}/{filename}"}); err == nil {
+		t.Fatal("key template without {upload} should fail")
+	}
+	p, _ := New(config.App{})
+	req := Request{Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), VirtualPath: "/x/a.txt", Filename: "a.txt"}
+	if _, _, err := p.Place(req); err == nil {
+		t.Fatal("missing upload id should fail")
+	}
+	req.Upload = "u1"
+	_, k1, _ := p.Place(req)
+	req.Upload = "u2"
+	_, k2, _ := p.Place(req)
+	if k1 == k2 {
+		t.Fatalf("re-upload reused key %s", k1)
+	}
+}
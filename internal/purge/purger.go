@@ -0,0 +1,91 @@
+package purge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/example/fuses3redispostgres/internal/s3io"
+	"go.uber.org/zap"
+)
+
+// Purger marks rows that stayed deleted for longer than Grace as purged and
+// removes their stored object once no other row references it.
+type Purger struct {
+	Repo  Repo
+	Store Store
+	Log   *zap.Logger
+	Grace time.Duration
+	Batch int
+}
+
+// Repo is the part of metadata.Repository the purger uses.
+type Repo interface {
+	ListPurgeable(ctx context.Context, deletedBefore time.Time, limit int) ([]metadata.PurgeCandidate, error)
+	TransitionRow(ctx context.Context, id int64, datePartition time.Time, from, to string) (bool, error)
+	CountReferences(ctx context.Context, bucket, key string, versionID *string) (int64, error)
+	DeleteDecompressIndex(ctx context.Context, bucket, key, etag, codec string) error
+}
+
+// Store routes a bucket to its storage, like s3io.Backends.
+type Store interface {
+	Storage(bucket string) s3io.Storage
+}
+
+func (p *Purger) Run(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		if n, err := p.RunOnce(ctx); err != nil {
+			p.Log.Error("purge pass failed", zap.Error(err))
+		} else if n > 0 {
+			p.Log.Info("purged objects", zap.Int("count", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (p *Purger) RunOnce(ctx context.Context) (int, error) {
+	batch := p.Batch
+	if batch <= 0 {
+		batch = 100
+	}
+	candidates, err := p.Repo.ListPurgeable(ctx, time.Now().Add(-p.Grace), batch)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, c := range candidates {
+		ok, err := p.Repo.TransitionRow(ctx, c.ID, c.DatePartition, metadata.StatusDeleted, metadata.StatusPurged)
+		if err != nil {
+			return purged, err
+		}
+		if !ok {
+			continue
+		}
+		refs, err := p.Repo.CountReferences(ctx, c.Bucket, c.Key, c.VersionID)
+		if err != nil {
+			return purged, err
+		}
+		if refs > 0 {
+			purged++
+			continue
+		}
+		if err := p.Store.Storage(c.Bucket).Delete(ctx, c.Bucket, c.Key, c.VersionID); err != nil {
+			if _, rerr := p.Repo.TransitionRow(ctx, c.ID, c.DatePartition, metadata.StatusPurged, metadata.StatusDeleted); rerr != nil {
+				p.Log.Error("revert purge", zap.String("path", c.VirtualPath), zap.Error(rerr))
+			}
+			return purged, fmt.Errorf("delete object %s/%s: %w", c.Bucket, c.Key, err)
+		}
+		if err := p.Repo.DeleteDecompressIndex(ctx, c.Bucket, c.Key, c.ETag, ""); err != nil {
+			p.Log.Warn("drop decompress index", zap.String("path", c.VirtualPath), zap.Error(err))
+		}
+		purged++
+	}
+	return purged, nil
+}
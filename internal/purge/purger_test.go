@@ -0,0 +1,111 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/example/fuses3redispostgres/internal/s3io"
+	"go.uber.org/zap"
+)
+
+type row struct {
+	metadata.PurgeCandidate
+	status    string
+	changedAt time.Time
+}
+
+type memRepo struct {
+	rows []*row
+}
+
+func (m *memRepo) ListPurgeable(_ context.Context, deletedBefore time.Time, limit int) ([]metadata.PurgeCandidate, error) {
+	var out []metadata.PurgeCandidate
+	for _, r := range m.rows {
+		if r.status == metadata.StatusDeleted && r.changedAt.Before(deletedBefore) && len(out) < limit {
+			out = append(out, r.PurgeCandidate)
+		}
+	}
+	return out, nil
+}
+
+func (m *memRepo) TransitionRow(_ context.Context, id int64, _ time.Time, from, to string) (bool, error) {
+	for _, r := range m.rows {
+		if r.ID == id && r.status == from {
+			r.status, r.changedAt = to, time.Now()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memRepo) CountReferences(_ context.Context, bucket, key string, versionID *string) (int64, error) {
+	var n int64
+	for _, r := range m.rows {
+		if r.Bucket == bucket && r.Key == key && r.VersionID == versionID && r.status != metadata.StatusPurged {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memRepo) DeleteDecompressIndex(context.Context, string, string, string, string) error {
+	return nil
+}
+
+// memStorage records deletes; the rest of s3io.Storage is not used.
+type memStorage struct {
+	s3io.Storage
+	deleted []string
+	err     error
+}
+
+func (m *memStorage) Delete(_ context.Context, _, key string, _ *string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.deleted = append(m.deleted, key)
+	return nil
+}
+
+type memBackends struct{ st *memStorage }
+
+func (b memBackends) Storage(string) s3io.Storage { return b.st }
+
+func deletedRow(id int64, key string, age time.Duration) *row {
+	return &row{PurgeCandidate: metadata.PurgeCandidate{ID: id, VirtualPath: "/" + key, Bucket: "b", Key: key}, status: metadata.StatusDeleted, changedAt: time.Now().Add(-age)}
+}
+
+func TestRunOncePurgesAfterGrace(t *testing.T) {
+	shared := deletedRow(3, "shared", 2*time.Hour)
+	live := &row{PurgeCandidate: metadata.PurgeCandidate{ID: 4, Bucket: "b", Key: "shared"}, status: metadata.StatusActive}
+	repo := &memRepo{rows: []*row{deletedRow(1, "old", 2*time.Hour), deletedRow(2, "recent", 10*time.Minute), shared, live}}
+	store := &memStorage{}
+	p := &Purger{Repo: repo, Store: memBackends{store}, Log: zap.NewNop(), Grace: time.Hour}
+	n, err := p.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("purged %d rows, want 2", n)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "old" {
+		t.Fatalf("deleted %v, want only the unreferenced object past the grace period", store.deleted)
+	}
+	if repo.rows[1].status != metadata.StatusDeleted || shared.status != metadata.StatusPurged {
+		t.Fatalf("statuses %s/%s, want deleted/purged", repo.rows[1].status, shared.status)
+	}
+}
+
+func TestRunOnceRevertsWhenDeleteFails(t *testing.T) {
+	r := deletedRow(1, "old", 2*time.Hour)
+	p := &Purger{Repo: &memRepo{rows: []*row{r}}, Store: memBackends{&memStorage{err: errors.New("access denied")}}, Log: zap.NewNop(), Grace: time.Hour}
+	if _, err := p.RunOnce(context.Background()); err == nil {
+		t.Fatal("want the delete error")
+	}
+	if r.status != metadata.StatusDeleted {
+		t.Fatalf("status %s after a failed delete, want deleted", r.status)
+	}
+}
@@ -0,0 +1,70 @@
+package s3io
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/example/fuses3redispostgres/internal/config"
+)
+
+const defaultBackend = "default"
+
+// Backends maps buckets to named stores. Routes are checked in order and
+// buckets that match none use the default backend built from the top-level
+// STORAGE_TYPE and S3_* settings.
+type Backends struct {
+	byName map[string]Storage
+	routes []config.BucketRoute
+}
+
+func NewBackends(ctx context.Context, cfg config.App) (*Backends, error) {
+	b := &Backends{byName: map[string]Storage{}, routes: cfg.S3BucketRoutes}
+	for _, bc := range append([]config.S3Backend{cfg.DefaultS3Backend()}, cfg.S3Backends...) {
+		if _, dup := b.byName[bc.Name]; dup {
+			return nil, fmt.Errorf("duplicate storage backend %q", bc.Name)
+		}
+		st, err := newStorage(ctx, bc)
+		if err != nil {
+			return nil, err
+		}
+		b.byName[bc.Name] = st
+	}
+	for _, r := range b.routes {
+		if _, err := path.Match(r.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("bucket route %q: %w", r.Pattern, err)
+		}
+		if _, ok := b.byName[r.Backend]; !ok {
+			return nil, fmt.Errorf("bucket route %q: unknown backend %q", r.Pattern, r.Backend)
+		}
+	}
+	return b, nil
+}
+
+func newStorage(ctx context.Context, bc config.S3Backend) (Storage, error) {
+	switch bc.Type {
+	case "", "s3":
+		c, err := NewClient(ctx, bc)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Storage(c), nil
+	case "local":
+		return NewLocalStorage(bc.Root)
+	default:
+		return nil, fmt.Errorf("backend %s: unknown storage type %q", bc.Name, bc.Type)
+	}
+}
+
+// Name returns the backend that serves bucket.
+func (b *Backends) Name(bucket string) string {
+	for _, r := range b.routes {
+		if ok, _ := path.Match(r.Pattern, bucket); ok {
+			return r.Backend
+		}
+	}
+	return defaultBackend
+}
+
+// Storage returns the store that holds bucket.
+func (b *Backends) Storage(bucket string) Storage { return b.byName[b.Name(bucket)] }
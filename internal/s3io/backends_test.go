@@ -0,0 +1,37 @@
+package s3io
+
+import (
+	"context"
+	"testing"
+
+	"github.com/example/fuses3redispostgres/internal/config"
+)
+
+func TestBackendRouting(t *testing.T) {
+	cfg := config.App{
+		S3Region:       "us-east-1",
+		S3Backends:     []config.S3Backend{{Name: "onprem", Region: "us-east-1", Endpoint: "http://minio:9000", PathStyle: true}},
+		S3BucketRoutes: []config.BucketRoute{{Pattern: "archive-*", Backend: "onprem"}},
+	}
+	b, err := NewBackends(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Name("archive-2019"); got != "onprem" {
+		t.Fatalf("archive bucket routed to %q", got)
+	}
+	if got := b.Name("data-2024"); got != defaultBackend {
+		t.Fatalf("unrouted bucket routed to %q", got)
+	}
+	if ep := b.Storage("archive-2019").(*S3Storage).Client().Options().BaseEndpoint; ep == nil || *ep != "http://minio:9000" {
+		t.Fatalf("onprem client endpoint: %v", ep)
+	}
+	if b.Storage("data-2024") == b.Storage("archive-2019") {
+		t.Fatal("expected distinct stores")
+	}
+
+	cfg.S3BucketRoutes = []config.BucketRoute{{Pattern: "x-*", Backend: "missing"}}
+	if _, err := NewBackends(context.Background(), cfg); err == nil {
+		t.Fatal("expected error for unknown backend")
+	}
+}
@@ -0,0 +1,32 @@
+package s3io
+
+import (
+	"context"
+	"testing"
+
+	"github.com/example/fuses3redispostgres/internal/config"
+)
+
+func TestNewClientHonoursEndpoint(t *testing.T) {
+	c, err := NewClient(context.Background(), config.S3Backend{Region: "us-east-1", Endpoint: "http://localhost:4566", PathStyle: true, AccessKeyID: "test", SecretAccessKey: "test", MaxAttempts: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := c.Options()
+	if o.BaseEndpoint == nil || *o.BaseEndpoint != "http://localhost:4566" || !o.UsePathStyle {
+		t.Fatalf("endpoint options not applied: %v %v", o.BaseEndpoint, o.UsePathStyle)
+	}
+	if o.Retryer.MaxAttempts() != 5 {
+		t.Fatalf("max attempts: %d", o.Retryer.MaxAttempts())
+	}
+	creds, err := o.Credentials.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "test" {
+		t.Fatalf("static credentials: %v %v", creds.AccessKeyID, err)
+	}
+}
+
+func TestNewClientMissingCABundle(t *testing.T) {
+	if _, err := NewClient(context.Background(), config.S3Backend{Region: "us-east-1", CABundle: "/nonexistent/ca.pem"}); err == nil {
+		t.Fatal("expected error for missing CA bundle")
+	}
+}
@@ -0,0 +1,49 @@
+package s3io
+
+import (
+	"context"
+	"io"
+
+	"github.com/example/fuses3redispostgres/internal/decompress"
+)
+
+// NewDecodedReader returns an io.ReadSeekCloser over the decompressed
+// content of an object stored with codec. Objects compressed on ingest end
+// in a seek table, so building the index reads only their tail.
+func NewDecodedReader(ctx context.Context, r *Reader, bucket, key, versionID, etag string, size int64, codec string) (io.ReadSeekCloser, error) {
+	src := &rangeReaderAt{ctx: ctx, r: r, bucket: bucket, key: key, version: versionID, etag: etag, size: size}
+	ix, err := decompress.Build(decompress.Codec(codec), src, size, decompress.DefaultFrameSize)
+	if err != nil {
+		return nil, err
+	}
+	return ix.NewReader(src, size, 0)
+}
+
+// rangeReaderAt reads an object through GetRange, so concurrent readers of
+// the same ranges share fetches and the memory cache.
+type rangeReaderAt struct {
+	ctx     context.Context
+	r       *Reader
+	bucket  string
+	key     string
+	version string
+	etag    string
+	size    int64
+}
+
+func (a *rangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= a.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), a.size) - 1
+	blk, err := a.r.GetRange(a.ctx, a.bucket, a.key, a.version, a.etag, off, end)
+	if err != nil {
+		return 0, err
+	}
+	defer blk.Release()
+	n := copy(p, blk.Data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,100 @@
+package s3io
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// throttleCooldown spaces out decreases so one burst of SlowDown replies
+// from requests that were already in flight only halves the limit once.
+const throttleCooldown = time.Second
+
+// limiter caps in-flight requests to one bucket. The cap follows AIMD: each
+// success raises it by 1/limit, so it grows by about one per limit's worth
+// of requests, and a throttled reply halves it. It never leaves [min, max].
+type limiter struct {
+	bucket string
+	min    float64
+	max    float64
+
+	mu       sync.Mutex
+	limit    float64
+	inUse    int
+	wake     chan struct{}
+	cooldown time.Time
+}
+
+func newLimiter(bucket string, start, min, max int64) *limiter {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if start < min {
+		start = min
+	}
+	if start > max {
+		start = max
+	}
+	l := &limiter{bucket: bucket, min: float64(min), max: float64(max), limit: float64(start), wake: make(chan struct{})}
+	bucketLimit.WithLabelValues(bucket).Set(l.limit)
+	return l
+}
+
+func (l *limiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inUse < int(l.limit) {
+			l.inUse++
+			bucketInflight.WithLabelValues(l.bucket).Set(float64(l.inUse))
+			l.mu.Unlock()
+			return nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees a slot and adjusts the limit: throttled requests shrink it,
+// successful ones grow it. Other errors leave it alone.
+func (l *limiter) release(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inUse--
+	bucketInflight.WithLabelValues(l.bucket).Set(float64(l.inUse))
+	switch {
+	case errors.Is(err, ErrThrottled):
+		now := time.Now()
+		if now.Before(l.cooldown) {
+			break
+		}
+		l.cooldown = now.Add(throttleCooldown)
+		l.limit /= 2
+		if l.limit < l.min {
+			l.limit = l.min
+		}
+		throttles.WithLabelValues(l.bucket).Inc()
+	case err == nil:
+		l.limit += 1 / l.limit
+		if l.limit > l.max {
+			l.limit = l.max
+		}
+	}
+	bucketLimit.WithLabelValues(l.bucket).Set(l.limit)
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+func (l *limiter) current() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
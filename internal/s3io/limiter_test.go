@@ -0,0 +1,60 @@
+package s3io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLimiterAIMD(t *testing.T) {
+	l := newLimiter("test-aimd", 4, 2, 8)
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		if err := l.acquire(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(short); err == nil {
+		t.Fatal("acquired past the limit")
+	}
+
+	for i := 0; i < 4; i++ {
+		l.release(nil)
+	}
+	if got := l.current(); got <= 4 || got > 5 {
+		t.Fatalf("after 4 successes limit = %v", got)
+	}
+
+	throttled := fmt.Errorf("get: %w", ErrThrottled)
+	before := l.current()
+	l.acquire(ctx)
+	l.acquire(ctx)
+	l.release(throttled)
+	l.release(throttled)
+	if got := l.current(); got != before/2 {
+		t.Fatalf("throttle burst: limit = %v, want %v", got, before/2)
+	}
+	l.cooldown = time.Time{}
+	l.acquire(ctx)
+	l.release(throttled)
+	if got := l.current(); got != 2 {
+		t.Fatalf("limit went below min: %v", got)
+	}
+
+	l.acquire(ctx)
+	l.release(errors.New("other"))
+	if got := l.current(); got != 2 {
+		t.Fatalf("unrelated error changed limit: %v", got)
+	}
+	for i := 0; i < 1000; i++ {
+		l.acquire(ctx)
+		l.release(nil)
+	}
+	if got := l.current(); got != 8 {
+		t.Fatalf("limit not capped at max: %v", got)
+	}
+}
@@ -0,0 +1,200 @@
+package s3io
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const uploadsDir = ".uploads"
+
+// LocalStorage keeps objects as files under <root>/<bucket>/<key>. It has no
+// object versions; ETags are the hex MD5 of the content. Multipart parts are
+// staged under <root>/.uploads/<id>.
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	if root == "" {
+		return nil, errors.New("local storage needs a root directory")
+	}
+	if err := os.MkdirAll(filepath.Join(root, uploadsDir), 0o755); err != nil {
+		return nil, fmt.Errorf("create storage root: %w", err)
+	}
+	return &LocalStorage{root: root}, nil
+}
+
+// GetRange ignores etag: checking it would mean hashing the whole file.
+func (l *LocalStorage) GetRange(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (io.ReadCloser, error) {
+	p, err := l.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("open object: %w", localErr(err))
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("seek object: %w", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, end-start+1), f}, nil
+}
+
+func (l *LocalStorage) Put(ctx context.Context, bucket, key string, body io.Reader) (PutResult, error) {
+	p, err := l.objectPath(bucket, key)
+	if err != nil {
+		return PutResult{}, err
+	}
+	etag, err := writeAtomic(p, body)
+	if err != nil {
+		return PutResult{}, err
+	}
+	return PutResult{ETag: etag}, nil
+}
+
+func (l *LocalStorage) Delete(ctx context.Context, bucket, key string, versionID *string) error {
+	p, err := l.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete object: %w", err)
+	}
+	return nil
+}
+
+func (l *LocalStorage) CreateMultipart(ctx context.Context, bucket, key string) (string, error) {
+	if _, err := l.objectPath(bucket, key); err != nil {
+		return "", err
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	id := hex.EncodeToString(b)
+	if err := os.MkdirAll(filepath.Join(l.root, uploadsDir, id), 0o755); err != nil {
+		return "", fmt.Errorf("create upload dir: %w", err)
+	}
+	return id, nil
+}
+
+func (l *LocalStorage) UploadPart(ctx context.Context, bucket, key, uploadID string, n int32, body io.ReadSeeker, size int64) (string, error) {
+	dir, err := l.uploadDir(uploadID)
+	if err != nil {
+		return "", err
+	}
+	return writeAtomic(filepath.Join(dir, strconv.Itoa(int(n))), io.LimitReader(body, size))
+}
+
+func (l *LocalStorage) CompleteMultipart(ctx context.Context, bucket, key, uploadID string, parts []CompletedPart) (PutResult, error) {
+	dir, err := l.uploadDir(uploadID)
+	if err != nil {
+		return PutResult{}, err
+	}
+	p, err := l.objectPath(bucket, key)
+	if err != nil {
+		return PutResult{}, err
+	}
+	files := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(int(part.Number))))
+		if err != nil {
+			return PutResult{}, fmt.Errorf("open part %d: %w", part.Number, err)
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	etag, err := writeAtomic(p, io.MultiReader(files...))
+	if err != nil {
+		return PutResult{}, err
+	}
+	os.RemoveAll(dir)
+	return PutResult{ETag: etag}, nil
+}
+
+func (l *LocalStorage) AbortMultipart(ctx context.Context, bucket, key, uploadID string) error {
+	dir, err := l.uploadDir(uploadID)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("abort upload: %w", err)
+	}
+	return nil
+}
+
+func (l *LocalStorage) PresignGet(ctx context.Context, bucket, key string, ttl time.Duration) (PresignedURL, error) {
+	return PresignedURL{}, ErrPresignUnsupported
+}
+
+// objectPath maps bucket and key below the root, refusing anything that
+// would escape the bucket directory.
+func (l *LocalStorage) objectPath(bucket, key string) (string, error) {
+	if bucket == "" || bucket == uploadsDir || strings.ContainsAny(bucket, `/\`) || bucket == "." || bucket == ".." {
+		return "", fmt.Errorf("invalid bucket %q", bucket)
+	}
+	base := filepath.Join(l.root, bucket)
+	p := filepath.Join(base, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, base+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return p, nil
+}
+
+func (l *LocalStorage) uploadDir(id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return "", fmt.Errorf("invalid upload id %q", id)
+	}
+	dir := filepath.Join(l.root, uploadsDir, id)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("upload %s: %w", id, localErr(err))
+	}
+	return dir, nil
+}
+
+// writeAtomic copies r into a temporary file next to p and renames it into
+// place. It returns the hex MD5 of what was written.
+func writeAtomic(p string, r io.Reader) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", fmt.Errorf("create object dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("create object file: %w", err)
+	}
+	h := md5.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("write object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("close object: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("commit object: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func localErr(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %v", ErrNotExist, err)
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package s3io
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	l, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := l.Put(ctx, "data-2024", "2024/01/02/ab/file.txt", strings.NewReader("hello world"))
+	if err != nil || res.ETag != "5eb63bbbe01eeed093cb22bb8f5acdc3" {
+		t.Fatalf("put: %+v %v", res, err)
+	}
+	body, err := l.GetRange(ctx, "data-2024", "2024/01/02/ab/file.txt", "", "", 6, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(body)
+	body.Close()
+	if string(got) != "world" {
+		t.Fatalf("range: %q", got)
+	}
+	if err := l.Delete(ctx, "data-2024", "2024/01/02/ab/file.txt", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.GetRange(ctx, "data-2024", "2024/01/02/ab/file.txt", "", "", 0, 1); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+	if _, err := l.Put(ctx, "data-2024", "../../etc/passwd", strings.NewReader("x")); err == nil {
+		t.Fatal("expected key escaping the bucket to be rejected")
+	}
+}
+
+func TestLocalStorageMultipart(t *testing.T) {
+	ctx := context.Background()
+	l, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := l.CreateMultipart(ctx, "b1", "big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []CompletedPart
+	for i, chunk := range []string{"abc", "def"} {
+		etag, err := l.UploadPart(ctx, "b1", "big.bin", id, int32(i+1), strings.NewReader(chunk), int64(len(chunk)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, CompletedPart{Number: int32(i + 1), ETag: etag})
+	}
+	if _, err := l.CompleteMultipart(ctx, "b1", "big.bin", id, parts); err != nil {
+		t.Fatal(err)
+	}
+	body, err := l.GetRange(ctx, "b1", "big.bin", "", "", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(body)
+	body.Close()
+	if string(got) != "abcdef" {
+		t.Fatalf("assembled: %q", got)
+	}
+	if err := l.AbortMultipart(ctx, "b1", "big.bin", id); err == nil {
+		t.Fatal("expected completed upload to be gone")
+	}
+}
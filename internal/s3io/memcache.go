@@ -0,0 +1,86 @@
+package s3io
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type memEntry struct {
+	key     string
+	blk     *Block
+	expires time.Time
+}
+
+// memCache keeps recently fetched ranges for a short time so readers that
+// arrive just after a fetch finished still share it. It is bounded by bytes
+// and evicts least recently used entries first. Each entry holds one
+// reference to its block.
+type memCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	max   int64
+	size  int64
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newMemCache(maxBytes int64, ttl time.Duration) *memCache {
+	return &memCache{ttl: ttl, max: maxBytes, order: list.New(), items: map[string]*list.Element{}}
+}
+
+// get returns a retained block; the caller releases it.
+func (m *memCache) get(key string) (*Block, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*memEntry)
+	if time.Now().After(e.expires) {
+		m.removeLocked(el)
+		return nil, false
+	}
+	m.order.MoveToFront(el)
+	return e.blk.Retain(), true
+}
+
+// put takes over one reference to blk.
+func (m *memCache) put(key string, blk *Block) {
+	if int64(len(blk.Data)) > m.max {
+		blk.Release()
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		m.removeLocked(el)
+	}
+	m.items[key] = m.order.PushFront(&memEntry{key: key, blk: blk, expires: time.Now().Add(m.ttl)})
+	m.size += int64(len(blk.Data))
+	for m.size > m.max {
+		m.removeLocked(m.order.Back())
+	}
+	memCacheBytes.Set(float64(m.size))
+}
+
+// shrink drops least recently used entries until n bytes were let go.
+func (m *memCache) shrink(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for freed := int64(0); freed < n && m.order.Len() > 0; {
+		el := m.order.Back()
+		freed += int64(len(el.Value.(*memEntry).blk.Data))
+		m.removeLocked(el)
+	}
+}
+
+func (m *memCache) removeLocked(el *list.Element) {
+	e := el.Value.(*memEntry)
+	m.order.Remove(el)
+	delete(m.items, e.key)
+	m.size -= int64(len(e.blk.Data))
+	memCacheBytes.Set(float64(m.size))
+	e.blk.Release()
+}
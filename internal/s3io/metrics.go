@@ -0,0 +1,55 @@
+package s3io
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	rangeRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "s3io_range_requests_total",
+		Help: "Range reads by how they were served: hit (memory cache), coalesced (joined an in-flight fetch) or fetched.",
+	}, []string{"result"})
+	memCacheBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "s3io_memory_cache_bytes",
+		Help: "Bytes held by the short-lived range cache.",
+	})
+	bucketLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "s3io_bucket_concurrency_limit",
+		Help: "Current adaptive limit on concurrent reads per bucket.",
+	}, []string{"bucket"})
+	bucketInflight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "s3io_bucket_inflight",
+		Help: "Reads currently in flight per bucket.",
+	}, []string{"bucket"})
+	throttles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "s3io_throttled_total",
+		Help: "Throttled replies (SlowDown or 503) that lowered a bucket's limit.",
+	}, []string{"bucket"})
+	readRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "s3io_read_retries_total",
+		Help: "Range read retries by reason: throttled, timeout or error.",
+	}, []string{"reason"})
+	hedgedReads = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "s3io_hedged_reads_total",
+		Help: "Second requests sent because an attempt outlasted the recent p95 latency.",
+	})
+	bufferBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "s3io_buffer_bytes_in_use",
+		Help: "Bytes held by live read buffers, including the memory cache.",
+	})
+	bufferCap = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "s3io_buffer_bytes_cap",
+		Help: "Cap on bytes held by live read buffers; 0 when uncapped.",
+	})
+	bufferAllocs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "s3io_buffer_allocations_total",
+		Help: "Read buffers allocated because none could be reused.",
+	})
+	bufferWaits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "s3io_buffer_waits_total",
+		Help: "Reads that had to wait for buffer memory under the cap.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(rangeRequests, memCacheBytes, bucketLimit, bucketInflight, throttles, readRetries, hedgedReads,
+		bufferBytes, bufferCap, bufferAllocs, bufferWaits)
+}
@@ -0,0 +1,80 @@
+package s3io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ObjectReader is an io.ReadSeeker over one object. It keeps a single ranged
+// GET open from the current offset and reopens it after a Seek, which lets
+// http.ServeContent handle Range and conditional requests. Every GET is
+// pinned to etag, so a reopened range never mixes in a replaced object.
+type ObjectReader struct {
+	ctx     context.Context
+	r       *Reader
+	bucket  string
+	key     string
+	version string
+	etag    string
+	size    int64
+	off     int64
+	body    io.ReadCloser
+}
+
+func NewObjectReader(ctx context.Context, r *Reader, bucket, key, versionID, etag string, size int64) *ObjectReader {
+	return &ObjectReader{ctx: ctx, r: r, bucket: bucket, key: key, version: versionID, etag: etag, size: size}
+}
+
+func (o *ObjectReader) Read(p []byte) (int, error) {
+	if o.off >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		body, err := o.r.Open(o.ctx, o.bucket, o.key, o.version, o.etag, o.off, o.size-1)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+	n, err := o.body.Read(p)
+	o.off += int64(n)
+	if errors.Is(err, io.EOF) && o.off < o.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (o *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	abs := offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		abs = o.off + offset
+	case io.SeekEnd:
+		abs = o.size + offset
+	default:
+		return 0, fmt.Errorf("seek: invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("seek: negative position %d", abs)
+	}
+	if abs != o.off {
+		o.closeBody()
+		o.off = abs
+	}
+	return abs, nil
+}
+
+func (o *ObjectReader) Close() error {
+	o.closeBody()
+	return nil
+}
+
+func (o *ObjectReader) closeBody() {
+	if o.body != nil {
+		_ = o.body.Close()
+		o.body = nil
+	}
+}
@@ -0,0 +1,23 @@
+package s3io
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+func TestObjectReaderSeek(t *testing.T) {
+	o := NewObjectReader(context.Background(), nil, "b", "k", "", "", 100)
+	if n, err := o.Seek(0, io.SeekEnd); err != nil || n != 100 {
+		t.Fatalf("seek end: %d %v", n, err)
+	}
+	if _, err := o.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("want EOF at end, got %v", err)
+	}
+	if n, err := o.Seek(-10, io.SeekCurrent); err != nil || n != 90 {
+		t.Fatalf("seek current: %d %v", n, err)
+	}
+	if _, err := o.Seek(-1, io.SeekStart); err == nil {
+		t.Fatal("expected error for negative position")
+	}
+}
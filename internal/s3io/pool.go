@@ -0,0 +1,141 @@
+package s3io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Block is a reference-counted buffer holding one fetched range. Data stays
+// valid until every holder has called Release; pooled buffers are then
+// reused, so holders must not keep Data past their Release.
+type Block struct {
+	Data []byte
+	refs atomic.Int32
+	pool *Pool
+	buf  *[]byte
+}
+
+// NewBlock wraps data that did not come from a pool. It has one reference.
+func NewBlock(data []byte) *Block {
+	b := &Block{Data: data}
+	b.refs.Store(1)
+	return b
+}
+
+// Retain adds a reference and returns b for convenience.
+func (b *Block) Retain() *Block {
+	b.refs.Add(1)
+	return b
+}
+
+// Release drops a reference, returning the buffer to its pool on the last.
+func (b *Block) Release() {
+	n := b.refs.Add(-1)
+	if n > 0 {
+		return
+	}
+	if n < 0 {
+		panic("s3io: block released too many times")
+	}
+	if b.pool != nil {
+		b.pool.put(b)
+	}
+}
+
+// ErrBuffersFull is returned to speculative reads when the buffer memory cap
+// is reached.
+var ErrBuffersFull = errors.New("buffer memory cap reached")
+
+type speculativeKey struct{}
+
+// Speculative marks reads made with ctx as read-ahead: they fail with
+// ErrBuffersFull instead of waiting for buffer memory, since blocks held in
+// read-ahead buffers cannot be reclaimed and would stall foreground reads.
+func Speculative(ctx context.Context) context.Context {
+	return context.WithValue(ctx, speculativeKey{}, true)
+}
+
+func isSpeculative(ctx context.Context) bool {
+	return ctx.Value(speculativeKey{}) != nil
+}
+
+// Pool hands out block-sized buffers and bounds the bytes held by live
+// blocks. Requests larger than the block size get a one-off buffer that
+// still counts against the cap.
+type Pool struct {
+	size int64
+	max  int64
+	mem  *semaphore.Weighted
+	bufs sync.Pool
+	// reclaim is called when the cap is reached, to ask holders of idle
+	// blocks (the memory cache) to let go of about n bytes.
+	reclaim func(n int64)
+}
+
+// NewPool returns a pool of blockSize buffers. maxBytes caps the bytes held
+// by live blocks; 0 means no cap.
+func NewPool(blockSize, maxBytes int64) *Pool {
+	p := &Pool{size: blockSize, max: maxBytes}
+	if maxBytes > 0 {
+		p.mem = semaphore.NewWeighted(maxBytes)
+	}
+	bufferCap.Set(float64(maxBytes))
+	return p
+}
+
+// Get returns a block with n bytes of Data, waiting for memory under the
+// cap to free up if needed. Speculative reads do not wait.
+func (p *Pool) Get(ctx context.Context, n int64) (*Block, error) {
+	if p.mem != nil {
+		if n > p.max {
+			return nil, fmt.Errorf("range of %d bytes exceeds buffer memory cap of %d", n, p.max)
+		}
+		if !p.mem.TryAcquire(n) {
+			bufferWaits.Inc()
+			if p.reclaim != nil {
+				p.reclaim(n)
+			}
+			if isSpeculative(ctx) {
+				if !p.mem.TryAcquire(n) {
+					return nil, ErrBuffersFull
+				}
+			} else if err := p.mem.Acquire(ctx, n); err != nil {
+				return nil, fmt.Errorf("acquire buffer memory: %w", err)
+			}
+		}
+	}
+	bufferBytes.Add(float64(n))
+	b := &Block{pool: p}
+	b.refs.Store(1)
+	if n <= p.size {
+		if v, ok := p.bufs.Get().(*[]byte); ok {
+			b.buf = v
+		} else {
+			bufferAllocs.Inc()
+			s := make([]byte, p.size)
+			b.buf = &s
+		}
+		b.Data = (*b.buf)[:n]
+		return b, nil
+	}
+	bufferAllocs.Inc()
+	b.Data = make([]byte, n)
+	return b, nil
+}
+
+func (p *Pool) put(b *Block) {
+	n := int64(len(b.Data))
+	if b.buf != nil {
+		p.bufs.Put(b.buf)
+	}
+	b.Data, b.buf = nil, nil
+	bufferBytes.Sub(float64(n))
+	if p.mem != nil {
+		p.mem.Release(n)
+	}
+}
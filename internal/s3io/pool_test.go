@@ -0,0 +1,97 @@
+package s3io
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPoolCapsLiveBytes(t *testing.T) {
+	p := NewPool(4, 8)
+	ctx := context.Background()
+	a, err := p.Get(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.Get(ctx, 3)
+	if err != nil || len(b.Data) != 3 {
+		t.Fatalf("got %v, %v", b, err)
+	}
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(short, 4); err == nil {
+		t.Fatal("allocated past the cap")
+	}
+	if _, err := p.Get(ctx, 9); err == nil {
+		t.Fatal("range larger than the cap should fail")
+	}
+
+	a.Retain()
+	a.Release()
+	got := make(chan *Block)
+	go func() {
+		c, _ := p.Get(ctx, 4)
+		got <- c
+	}()
+	select {
+	case <-got:
+		t.Fatal("block still referenced was reused")
+	case <-time.After(10 * time.Millisecond):
+	}
+	a.Release()
+	if c := <-got; len(c.Data) != 4 {
+		t.Fatalf("got %d bytes", len(c.Data))
+	}
+}
+
+func TestPoolReclaimsFromMemoryCache(t *testing.T) {
+	r := NewReader(&Backends{byName: map[string]Storage{}}, 1, 1)
+	r.CacheRanges(8, time.Minute)
+	r.Buffers(4, 8)
+	for _, k := range []string{"a", "b"} {
+		blk, err := r.pool.Get(context.Background(), 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.memory.put(k, blk)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	blk, err := r.pool.Get(ctx, 4)
+	if err != nil {
+		t.Fatalf("cache did not give up memory: %v", err)
+	}
+	blk.Release()
+	if _, ok := r.memory.get("a"); ok {
+		t.Fatal("oldest entry kept")
+	}
+}
+
+func TestPoolSkipsReadAheadWhenFull(t *testing.T) {
+	p := NewPool(4, 8)
+	ctx := context.Background()
+	a, _ := p.Get(ctx, 4)
+	b, _ := p.Get(ctx, 4)
+	if _, err := p.Get(Speculative(ctx), 4); !errors.Is(err, ErrBuffersFull) {
+		t.Fatalf("read-ahead waited or allocated past the cap: %v", err)
+	}
+	got := make(chan *Block)
+	go func() {
+		c, _ := p.Get(ctx, 4)
+		got <- c
+	}()
+	a.Release()
+	select {
+	case c := <-got:
+		c.Release()
+	case <-time.After(time.Second):
+		t.Fatal("foreground read stalled")
+	}
+	if c, err := p.Get(Speculative(ctx), 4); err != nil {
+		t.Fatalf("read-ahead refused with memory free: %v", err)
+	} else {
+		c.Release()
+	}
+	b.Release()
+}
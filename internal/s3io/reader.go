@@ -2,54 +2,226 @@ package s3io
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"golang.org/x/sync/semaphore"
 )
 
 type Reader struct {
-	client   *s3.Client
+	backends *Backends
+	memory   *memCache
+	pool     *Pool
 	global   *semaphore.Weighted
-	perBkt   map[string]*semaphore.Weighted
+	retry    RetryPolicy
+	lat      latencies
+
+	mu       sync.Mutex
+	calls    map[string]*call
+	perBkt   map[string]*limiter
 	perLimit int64
+	perMin   int64
+	perMax   int64
+}
+
+func NewReader(backends *Backends, globalLimit, perBucketLimit int64) *Reader {
+	r := &Reader{backends: backends, global: semaphore.NewWeighted(globalLimit), retry: RetryPolicy{Attempts: 1}, calls: map[string]*call{}, perBkt: map[string]*limiter{}, perLimit: perBucketLimit, perMin: perBucketLimit, perMax: perBucketLimit}
+	r.Buffers(0, 0)
+	return r
+}
+
+// Buffers makes range reads fill reusable blockSize buffers and caps the
+// bytes held by live blocks at maxBytes (0 for no cap). When the cap is hit
+// the memory cache gives up entries first.
+func (r *Reader) Buffers(blockSize, maxBytes int64) {
+	p := NewPool(blockSize, maxBytes)
+	p.reclaim = func(n int64) {
+		if r.memory != nil {
+			r.memory.shrink(n)
+		}
+	}
+	r.pool = p
+}
+
+// Retry sets how range reads are retried and hedged. Streams from Open are
+// not retried.
+func (r *Reader) Retry(p RetryPolicy) {
+	if p.Attempts < 1 {
+		p.Attempts = 1
+	}
+	r.retry = p
+}
+
+// Adapt lets each bucket's limit move between min and max, starting from
+// the per-bucket limit given to NewReader. Without it the limit is fixed.
+func (r *Reader) Adapt(min, max int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.perMin, r.perMax = min, max
+}
+
+func (r *Reader) bucketLimiter(bucket string) *limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if l, ok := r.perBkt[bucket]; ok {
+		return l
+	}
+	l := newLimiter(bucket, r.perLimit, r.perMin, r.perMax)
+	r.perBkt[bucket] = l
+	return l
+}
+
+// CacheRanges keeps fetched ranges in memory for ttl, up to maxBytes.
+func (r *Reader) CacheRanges(maxBytes int64, ttl time.Duration) {
+	if maxBytes > 0 && ttl > 0 {
+		r.memory = newMemCache(maxBytes, ttl)
+	}
+}
+
+// call is one shared fetch. Every waiter is owed one reference to the
+// block; references are added when the fetch settles.
+type call struct {
+	done    chan struct{}
+	blk     *Block
+	err     error
+	waiters int
+	settled bool
 }
 
-func NewReader(client *s3.Client, globalLimit, perBucketLimit int64) *Reader {
-	return &Reader{client: client, global: semaphore.NewWeighted(globalLimit), perBkt: map[string]*semaphore.Weighted{}, perLimit: perBucketLimit}
+// GetRange returns bytes [start, end] of an object. A non-empty etag must
+// match the stored object, so an overwrite fails with ErrChanged instead of
+// mixing content. Concurrent requests for the same range and ETag share one
+// fetch, and with CacheRanges a recent result is served from memory. The
+// caller owns one reference to the returned block and must Release it; Data
+// must not be modified.
+func (r *Reader) GetRange(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (*Block, error) {
+	for {
+		blk, err := r.getRange(ctx, bucket, key, versionID, etag, start, end)
+		// A foreground read that joined a read-ahead skipped for lack of
+		// buffers makes its own fetch, which waits for memory.
+		if errors.Is(err, ErrBuffersFull) && !isSpeculative(ctx) {
+			continue
+		}
+		return blk, err
+	}
 }
 
-func (r *Reader) bucketSem(bucket string) *semaphore.Weighted {
-	if s, ok := r.perBkt[bucket]; ok {
-		return s
+func (r *Reader) getRange(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (*Block, error) {
+	k := bucket + "\x00" + key + "\x00" + versionID + "\x00" + etag + "\x00" + strconv.FormatInt(start, 10) + "-" + strconv.FormatInt(end, 10)
+	if r.memory != nil {
+		if blk, ok := r.memory.get(k); ok {
+			rangeRequests.WithLabelValues("hit").Inc()
+			return blk, nil
+		}
+	}
+	r.mu.Lock()
+	c, joined := r.calls[k]
+	if joined {
+		c.waiters++
+	} else {
+		c = &call{done: make(chan struct{}), waiters: 1}
+		r.calls[k] = c
+	}
+	r.mu.Unlock()
+	if joined {
+		rangeRequests.WithLabelValues("coalesced").Inc()
+	} else {
+		rangeRequests.WithLabelValues("fetched").Inc()
+		// The fetch outlives any single caller's cancellation but keeps
+		// the caller's deadline.
+		fctx, cancel := context.WithoutCancel(ctx), context.CancelFunc(func() {})
+		if dl, ok := ctx.Deadline(); ok {
+			fctx, cancel = context.WithDeadline(fctx, dl)
+		}
+		go func() {
+			defer cancel()
+			r.settle(fctx, k, c, bucket, key, versionID, etag, start, end)
+		}()
+	}
+	select {
+	case <-c.done:
+		return c.blk, c.err
+	case <-ctx.Done():
+		r.mu.Lock()
+		if c.settled {
+			r.mu.Unlock()
+			if c.blk != nil {
+				c.blk.Release()
+			}
+		} else {
+			c.waiters--
+			r.mu.Unlock()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (r *Reader) settle(ctx context.Context, k string, c *call, bucket, key, versionID, etag string, start, end int64) {
+	blk, err := r.fetchRange(ctx, bucket, key, versionID, etag, start, end)
+	if err == nil && r.memory != nil {
+		r.memory.put(k, blk.Retain())
+	}
+	r.mu.Lock()
+	delete(r.calls, k)
+	c.blk, c.err, c.settled = blk, err, true
+	if blk != nil {
+		blk.refs.Add(int32(c.waiters))
+	}
+	close(c.done)
+	r.mu.Unlock()
+	if blk != nil {
+		blk.Release()
 	}
-	s := semaphore.NewWeighted(r.perLimit)
-	r.perBkt[bucket] = s
-	return s
 }
 
-func (r *Reader) GetRange(ctx context.Context, bucket, key string, start, end int64) ([]byte, error) {
+// Open streams bytes [start, end] of an object. A non-empty etag pins the
+// read like GetRange does. The concurrency slots stay held until the
+// returned body is closed.
+func (r *Reader) Open(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (io.ReadCloser, error) {
 	if err := r.global.Acquire(ctx, 1); err != nil {
 		return nil, fmt.Errorf("acquire global: %w", err)
 	}
-	defer r.global.Release(1)
-	bs := r.bucketSem(bucket)
-	if err := bs.Acquire(ctx, 1); err != nil {
+	bl := r.bucketLimiter(bucket)
+	if err := bl.acquire(ctx); err != nil {
+		r.global.Release(1)
 		return nil, fmt.Errorf("acquire bucket: %w", err)
 	}
-	defer bs.Release(1)
-	out, err := r.client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key, Range: ptr("bytes=" + strconv.FormatInt(start, 10) + "-" + strconv.FormatInt(end, 10))})
+	body, err := r.backends.Storage(bucket).GetRange(ctx, bucket, key, versionID, etag, start, end)
 	if err != nil {
-		return nil, fmt.Errorf("get object range: %w", err)
+		bl.release(err)
+		r.global.Release(1)
+		return nil, err
 	}
-	defer out.Body.Close()
-	buf, err := io.ReadAll(out.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
+	return &heldBody{ReadCloser: body, release: func() { bl.release(nil); r.global.Release(1) }}, nil
+}
+
+type heldBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *heldBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+func rangeInput(bucket, key, versionID, etag string, start, end int64) *s3.GetObjectInput {
+	in := &s3.GetObjectInput{Bucket: &bucket, Key: &key, Range: ptr("bytes=" + strconv.FormatInt(start, 10) + "-" + strconv.FormatInt(end, 10))}
+	if versionID != "" {
+		in.VersionId = &versionID
+	}
+	if etag != "" {
+		in.IfMatch = ptr(`"` + strings.Trim(etag, `"`) + `"`)
 	}
-	return buf, nil
+	return in
 }
 
 func ptr(s string) *string { return &s }
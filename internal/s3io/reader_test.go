@@ -0,0 +1,91 @@
+package s3io
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedStorage counts range fetches and holds each one until release closes.
+type gatedStorage struct {
+	Storage
+	fetches atomic.Int32
+	release chan struct{}
+}
+
+func (g *gatedStorage) GetRange(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (io.ReadCloser, error) {
+	g.fetches.Add(1)
+	<-g.release
+	return io.NopCloser(strings.NewReader("0123456789"[start : end+1])), nil
+}
+
+func TestReaderCoalescesAndCaches(t *testing.T) {
+	st := &gatedStorage{release: make(chan struct{})}
+	r := NewReader(&Backends{byName: map[string]Storage{defaultBackend: st}}, 8, 8)
+	r.CacheRanges(1<<20, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blk, err := r.GetRange(context.Background(), "b", "k", "", "", 2, 5)
+			if err != nil || string(blk.Data) != "2345" {
+				t.Errorf("got %v, %v", blk, err)
+				return
+			}
+			blk.Release()
+		}()
+	}
+	for st.fetches.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(st.release)
+	wg.Wait()
+	if n := st.fetches.Load(); n != 1 {
+		t.Fatalf("concurrent reads made %d fetches", n)
+	}
+
+	for _, rng := range []struct {
+		etag       string
+		start, end int64
+	}{{"", 2, 5}, {"", 0, 1}, {"e2", 2, 5}} {
+		blk, err := r.GetRange(context.Background(), "b", "k", "", rng.etag, rng.start, rng.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blk.Release()
+	}
+	if n := st.fetches.Load(); n != 3 {
+		t.Fatalf("expected one cached hit and two new fetches, got %d fetches", n)
+	}
+}
+
+func TestMemCacheEvicts(t *testing.T) {
+	m := newMemCache(8, time.Minute)
+	a, b := NewBlock(make([]byte, 4)), NewBlock(make([]byte, 4))
+	m.put("a", a.Retain())
+	m.put("b", b.Retain())
+	m.get("a")
+	m.put("c", NewBlock(make([]byte, 4)))
+	if _, ok := m.get("b"); ok {
+		t.Fatal("least recently used entry kept")
+	}
+	if b.refs.Load() != 1 {
+		t.Fatalf("evicted block still referenced by cache: refs=%d", b.refs.Load())
+	}
+	if _, ok := m.get("a"); !ok {
+		t.Fatal("recently used entry evicted")
+	}
+	m = newMemCache(8, time.Nanosecond)
+	m.put("a", NewBlock(make([]byte, 4)))
+	time.Sleep(time.Millisecond)
+	if _, ok := m.get("a"); ok {
+		t.Fatal("expired entry served")
+	}
+}
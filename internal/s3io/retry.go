@@ -0,0 +1,236 @@
+package s3io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/config"
+)
+
+// hedgeMinSamples is how many successful reads must be seen before the p95
+// is trusted as a hedging delay.
+const hedgeMinSamples = 20
+
+// RetryPolicy controls how one range read is attempted. Each attempt has its
+// own deadline so a stalled connection is abandoned and retried instead of
+// eating the caller's whole budget. With Hedge set, an attempt still running
+// past the recent p95 latency gets a second request racing it.
+type RetryPolicy struct {
+	Attempts       int
+	AttemptTimeout time.Duration
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+	Hedge          bool
+}
+
+// RetryPolicyFrom builds the read policy from configuration. Without an
+// explicit attempt timeout, TIMEOUT is split evenly across attempts.
+func RetryPolicyFrom(cfg config.App) RetryPolicy {
+	p := RetryPolicy{Attempts: cfg.ReadAttempts, AttemptTimeout: cfg.AttemptTimeout, BaseDelay: cfg.ReadBackoff, MaxDelay: cfg.ReadMaxBackoff, Hedge: cfg.ReadHedge}
+	if p.Attempts < 1 {
+		p.Attempts = 1
+	}
+	if p.AttemptTimeout <= 0 && cfg.Timeout > 0 {
+		p.AttemptTimeout = cfg.Timeout / time.Duration(p.Attempts)
+	}
+	return p
+}
+
+// backoff returns a full-jitter delay before retry n (0-based).
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay << n
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+type singleAttemptKey struct{}
+
+// singleAttempt asks the store not to retry requests made with ctx.
+func singleAttempt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, singleAttemptKey{}, true)
+}
+
+// retryable reports whether another attempt could succeed. Nothing is
+// retried once the caller's own context is done.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return !errors.Is(err, ErrNotExist) && !errors.Is(err, ErrRejected) && !errors.Is(err, ErrChanged) && !errors.Is(err, ErrBuffersFull)
+}
+
+func retryReason(err error) string {
+	switch {
+	case errors.Is(err, ErrThrottled):
+		return "throttled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "error"
+}
+
+// latencies keeps a window of recent successful read durations.
+type latencies struct {
+	mu   sync.Mutex
+	buf  [128]time.Duration
+	n    int
+	next int
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf[l.next] = d
+	l.next = (l.next + 1) % len(l.buf)
+	if l.n < len(l.buf) {
+		l.n++
+	}
+}
+
+func (l *latencies) p95() (time.Duration, bool) {
+	l.mu.Lock()
+	if l.n < hedgeMinSamples {
+		l.mu.Unlock()
+		return 0, false
+	}
+	s := append([]time.Duration(nil), l.buf[:l.n]...)
+	l.mu.Unlock()
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s[len(s)*95/100], true
+}
+
+// fetchRange runs the retry loop around hedged attempts.
+func (r *Reader) fetchRange(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (*Block, error) {
+	var err error
+	for n := 0; ; n++ {
+		var blk *Block
+		if blk, err = r.hedged(ctx, bucket, key, versionID, etag, start, end); err == nil {
+			return blk, nil
+		}
+		if n+1 >= r.retry.Attempts || !retryable(ctx, err) {
+			break
+		}
+		readRetries.WithLabelValues(retryReason(err)).Inc()
+		t := time.NewTimer(r.retry.backoff(n))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, fmt.Errorf("%w (last attempt: %v)", ctx.Err(), err)
+		}
+	}
+	if cerr := ctx.Err(); cerr != nil && !errors.Is(err, cerr) {
+		return nil, fmt.Errorf("%w (last attempt: %v)", cerr, err)
+	}
+	return nil, err
+}
+
+// hedged runs one attempt and, when hedging is on and it outlasts the recent
+// p95, a second one; the first success wins and the other is cancelled.
+func (r *Reader) hedged(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (*Block, error) {
+	delay, ok := r.lat.p95()
+	if !r.retry.Hedge || !ok {
+		return r.attempt(ctx, bucket, key, versionID, etag, start, end)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		blk *Block
+		err error
+	}
+	results := make(chan result, 2)
+	launch := func() {
+		go func() {
+			blk, err := r.attempt(ctx, bucket, key, versionID, etag, start, end)
+			results <- result{blk, err}
+		}()
+	}
+	launch()
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	pending := 1
+	for {
+		select {
+		case <-t.C:
+			hedgedReads.Inc()
+			launch()
+			pending++
+		case res := <-results:
+			pending--
+			if res.err == nil || pending == 0 {
+				if pending > 0 {
+					// Release the loser's buffer once it gives up.
+					go func() {
+						if res := <-results; res.blk != nil {
+							res.blk.Release()
+						}
+					}()
+				}
+				return res.blk, res.err
+			}
+		}
+	}
+}
+
+// attempt makes a single request under the concurrency limits and the
+// per-attempt deadline. The buffer is taken before a concurrency slot so
+// waiting for memory does not hold one.
+func (r *Reader) attempt(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (*Block, error) {
+	blk, err := r.pool.Get(ctx, end-start+1)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.global.Acquire(ctx, 1); err != nil {
+		blk.Release()
+		return nil, fmt.Errorf("acquire global: %w", err)
+	}
+	defer r.global.Release(1)
+	bl := r.bucketLimiter(bucket)
+	if err := bl.acquire(ctx); err != nil {
+		blk.Release()
+		return nil, fmt.Errorf("acquire bucket: %w", err)
+	}
+	actx := ctx
+	if r.retry.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		actx, cancel = context.WithTimeout(ctx, r.retry.AttemptTimeout)
+		defer cancel()
+	}
+	began := time.Now()
+	err = r.read(actx, bucket, key, versionID, etag, start, blk.Data)
+	if err != nil && ctx.Err() == nil && actx.Err() != nil {
+		err = fmt.Errorf("attempt timed out after %s: %w", r.retry.AttemptTimeout, context.DeadlineExceeded)
+	}
+	bl.release(err)
+	if err != nil {
+		blk.Release()
+		return nil, err
+	}
+	r.lat.add(time.Since(began))
+	return blk, nil
+}
+
+// read streams the range starting at start straight into dst. It makes a
+// single request: retries happen in fetchRange, where the limiter sees them.
+func (r *Reader) read(ctx context.Context, bucket, key, versionID, etag string, start int64, dst []byte) error {
+	body, err := r.backends.Storage(bucket).GetRange(singleAttempt(ctx), bucket, key, versionID, etag, start, start+int64(len(dst))-1)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if _, err := io.ReadFull(body, dst); err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	return nil
+}
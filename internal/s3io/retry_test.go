@@ -0,0 +1,112 @@
+package s3io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// scriptedStorage fails the first len(errs) reads with the given errors and
+// stalls reads listed in slow until their context ends.
+type scriptedStorage struct {
+	Storage
+	calls atomic.Int32
+	errs  []error
+	slow  map[int32]bool
+}
+
+func (s *scriptedStorage) GetRange(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (io.ReadCloser, error) {
+	n := s.calls.Add(1)
+	if s.slow[n] {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if int(n) <= len(s.errs) {
+		return nil, s.errs[n-1]
+	}
+	return io.NopCloser(strings.NewReader("data")), nil
+}
+
+func newScriptedReader(st Storage, p RetryPolicy) *Reader {
+	r := NewReader(&Backends{byName: map[string]Storage{defaultBackend: st}}, 8, 8)
+	r.Retry(p)
+	return r
+}
+
+func TestReaderRetries(t *testing.T) {
+	st := &scriptedStorage{errs: []error{fmt.Errorf("x: %w", ErrThrottled), errors.New("connection reset")}}
+	r := newScriptedReader(st, RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond})
+	if blk, err := r.fetchRange(context.Background(), "b", "k", "", "", 0, 3); err != nil || string(blk.Data) != "data" {
+		t.Fatalf("got %v, %v", blk, err)
+	}
+	if n := st.calls.Load(); n != 3 {
+		t.Fatalf("made %d calls", n)
+	}
+
+	st = &scriptedStorage{errs: []error{fmt.Errorf("x: %w", ErrNotExist)}}
+	r = newScriptedReader(st, RetryPolicy{Attempts: 3})
+	if _, err := r.fetchRange(context.Background(), "b", "k", "", "", 0, 3); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("got %v", err)
+	}
+	if n := st.calls.Load(); n != 1 {
+		t.Fatalf("missing object retried: %d calls", n)
+	}
+}
+
+func TestReaderAttemptTimeout(t *testing.T) {
+	st := &scriptedStorage{slow: map[int32]bool{1: true}}
+	r := newScriptedReader(st, RetryPolicy{Attempts: 2, AttemptTimeout: 10 * time.Millisecond})
+	if blk, err := r.fetchRange(context.Background(), "b", "k", "", "", 0, 3); err != nil || string(blk.Data) != "data" {
+		t.Fatalf("stalled attempt not retried: %v, %v", blk, err)
+	}
+
+	st = &scriptedStorage{slow: map[int32]bool{1: true, 2: true}}
+	r = newScriptedReader(st, RetryPolicy{Attempts: 2, AttemptTimeout: 10 * time.Millisecond})
+	if _, err := r.fetchRange(context.Background(), "b", "k", "", "", 0, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+}
+
+func TestReaderHedges(t *testing.T) {
+	st := &scriptedStorage{slow: map[int32]bool{1: true}}
+	r := newScriptedReader(st, RetryPolicy{Attempts: 1, Hedge: true})
+	for i := 0; i < hedgeMinSamples; i++ {
+		r.lat.add(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if blk, err := r.fetchRange(ctx, "b", "k", "", "", 0, 3); err != nil || string(blk.Data) != "data" {
+		t.Fatalf("hedge did not win: %v, %v", blk, err)
+	}
+	if n := st.calls.Load(); n != 2 {
+		t.Fatalf("made %d calls", n)
+	}
+}
+
+func TestClassifyRetriesRequestTimeout(t *testing.T) {
+	reply := func(status int, code string) error {
+		return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      &smithy.GenericAPIError{Code: code},
+		}}
+	}
+	if err := classify(reply(http.StatusBadRequest, "RequestTimeout")); !retryable(context.Background(), err) {
+		t.Fatalf("RequestTimeout not retried: %v", err)
+	}
+	if err := classify(reply(http.StatusForbidden, "AccessDenied")); !errors.Is(err, ErrRejected) {
+		t.Fatalf("got %v", err)
+	}
+	if err := classify(reply(http.StatusPreconditionFailed, "PreconditionFailed")); !errors.Is(err, ErrChanged) || retryable(context.Background(), err) {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package s3io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// S3Storage implements Storage on an S3 or S3-compatible endpoint.
+type S3Storage struct {
+	client    *s3.Client
+	uploader  *manager.Uploader
+	presigner *s3.PresignClient
+}
+
+func NewS3Storage(c *s3.Client) *S3Storage {
+	return &S3Storage{client: c, uploader: manager.NewUploader(c), presigner: s3.NewPresignClient(c)}
+}
+
+func (s *S3Storage) Client() *s3.Client { return s.client }
+
+func (s *S3Storage) GetRange(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (io.ReadCloser, error) {
+	var opts []func(*s3.Options)
+	if ctx.Value(singleAttemptKey{}) != nil {
+		opts = append(opts, func(o *s3.Options) { o.Retryer = aws.NopRetryer{} })
+	}
+	out, err := s.client.GetObject(ctx, rangeInput(bucket, key, versionID, etag, start, end), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("get object range: %w", classify(err))
+	}
+	return out.Body, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, bucket, key string, body io.Reader) (PutResult, error) {
+	out, err := s.uploader.Upload(ctx, &s3.PutObjectInput{Bucket: &bucket, Key: &key, Body: body})
+	if err != nil {
+		return PutResult{}, fmt.Errorf("put object: %w", err)
+	}
+	return PutResult{ETag: deref(out.ETag), VersionID: out.VersionID}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, bucket, key string, versionID *string) error {
+	if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &bucket, Key: &key, VersionId: versionID}); err != nil {
+		return fmt.Errorf("delete object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) CreateMultipart(ctx context.Context, bucket, key string) (string, error) {
+	out, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		return "", fmt.Errorf("create multipart upload: %w", err)
+	}
+	return deref(out.UploadId), nil
+}
+
+func (s *S3Storage) UploadPart(ctx context.Context, bucket, key, uploadID string, n int32, body io.ReadSeeker, size int64) (string, error) {
+	out, err := s.client.UploadPart(ctx, &s3.UploadPartInput{Bucket: &bucket, Key: &key, UploadId: &uploadID, PartNumber: &n, Body: body, ContentLength: &size})
+	if err != nil {
+		return "", fmt.Errorf("upload part: %w", err)
+	}
+	return deref(out.ETag), nil
+}
+
+func (s *S3Storage) CompleteMultipart(ctx context.Context, bucket, key, uploadID string, parts []CompletedPart) (PutResult, error) {
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, p := range parts {
+		completed = append(completed, types.CompletedPart{ETag: ptr(p.ETag), PartNumber: &p.Number})
+	}
+	out, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{Bucket: &bucket, Key: &key, UploadId: &uploadID, MultipartUpload: &types.CompletedMultipartUpload{Parts: completed}})
+	if err != nil {
+		return PutResult{}, fmt.Errorf("complete multipart upload: %w", err)
+	}
+	return PutResult{ETag: deref(out.ETag), VersionID: out.VersionId}, nil
+}
+
+func (s *S3Storage) AbortMultipart(ctx context.Context, bucket, key, uploadID string) error {
+	if _, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: &bucket, Key: &key, UploadId: &uploadID}); err != nil {
+		return fmt.Errorf("abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) PresignGet(ctx context.Context, bucket, key string, ttl time.Duration) (PresignedURL, error) {
+	out, err := s.presigner.PresignGetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return PresignedURL{}, fmt.Errorf("presign get: %w", err)
+	}
+	return PresignedURL{URL: out.URL, Method: out.Method}, nil
+}
+
+// classify maps SDK errors onto ErrNotExist, ErrThrottled, ErrChanged and
+// ErrRejected.
+func classify(err error) error {
+	var nsk *types.NoSuchKey
+	if errors.As(err, &nsk) {
+		return fmt.Errorf("%w: %v", ErrNotExist, err)
+	}
+	var api smithy.APIError
+	if errors.As(err, &api) {
+		switch api.ErrorCode() {
+		case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequestsException":
+			return fmt.Errorf("%w: %v", ErrThrottled, err)
+		case "PreconditionFailed":
+			return fmt.Errorf("%w: %v", ErrChanged, err)
+		case "RequestTimeout":
+			// S3 sends this as a 400, but a new request can succeed.
+			return err
+		}
+	}
+	var resp *awshttp.ResponseError
+	if errors.As(err, &resp) {
+		switch resp.HTTPStatusCode() {
+		case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+			return fmt.Errorf("%w: %v", ErrThrottled, err)
+		}
+		if code := resp.HTTPStatusCode(); code >= 400 && code < 500 && code != http.StatusRequestTimeout {
+			return fmt.Errorf("%w: %v", ErrRejected, err)
+		}
+	}
+	return err
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,60 @@
+package s3io
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotExist is returned when the requested object is not in the store.
+var ErrNotExist = errors.New("object does not exist")
+
+// ErrThrottled is returned when the store asks clients to slow down.
+var ErrThrottled = errors.New("request throttled by store")
+
+// ErrRejected is returned when the store refuses a request in a way that
+// retrying will not fix, such as access denied.
+var ErrRejected = errors.New("request rejected by store")
+
+// ErrChanged is returned when the object no longer has the ETag the caller
+// resolved, typically because it was overwritten in place.
+var ErrChanged = errors.New("object changed in store")
+
+// ErrPresignUnsupported is returned by stores that cannot hand out URLs.
+var ErrPresignUnsupported = errors.New("presigned URLs not supported by this backend")
+
+// PutResult describes an object that was written.
+type PutResult struct {
+	ETag      string
+	VersionID *string
+}
+
+// CompletedPart identifies one uploaded part of a multipart upload.
+type CompletedPart struct {
+	Number int32
+	ETag   string
+}
+
+// PresignedURL is a time-limited GET URL.
+type PresignedURL struct {
+	URL    string
+	Method string
+}
+
+// Storage is the object store behind the reader and the upload path.
+type Storage interface {
+	// GetRange streams bytes [start, end] of an object. A non-empty etag
+	// is a precondition: a store that can check it cheaply fails with
+	// ErrChanged when it no longer matches.
+	GetRange(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (io.ReadCloser, error)
+	Put(ctx context.Context, bucket, key string, body io.Reader) (PutResult, error)
+	Delete(ctx context.Context, bucket, key string, versionID *string) error
+
+	CreateMultipart(ctx context.Context, bucket, key string) (string, error)
+	UploadPart(ctx context.Context, bucket, key, uploadID string, n int32, body io.ReadSeeker, size int64) (string, error)
+	CompleteMultipart(ctx context.Context, bucket, key, uploadID string, parts []CompletedPart) (PutResult, error)
+	AbortMultipart(ctx context.Context, bucket, key, uploadID string) error
+
+	PresignGet(ctx context.Context, bucket, key string, ttl time.Duration) (PresignedURL, error)
+}
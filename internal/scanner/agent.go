@@ -23,6 +23,11 @@ type Agent struct {
 	Log        *zap.Logger
 	Limit      *rate.Limiter
 	Workers    int
+
+	// Files at or above MultipartThreshold are sent through a resumable
+	// upload session in PartSize pieces. Zero disables multipart.
+	PartSize           int64
+	MultipartThreshold int64
 }
 
 func (a *Agent) RunOnce() error {
@@ -52,6 +57,13 @@ func (a *Agent) sendFile(path string) error {
 	stat, _ := f.Stat()
 	date := stat.ModTime().Format("2006-01-02")
 	virtualPath := filepath.ToSlash(path)
+	if a.MultipartThreshold > 0 && stat.Size() >= a.MultipartThreshold {
+		if err := a.sendMultipart(path, f, stat, date, virtualPath); err != nil {
+			return err
+		}
+		a.Log.Info("uploaded", zap.String("path", path))
+		return a.markSent(path, stat)
+	}
 	url := fmt.Sprintf("%s/v1/upload?date=%s&path=%s", a.APIBaseURL, date, virtualPath)
 	req, _ := http.NewRequest(http.MethodPost, url, f)
 	req.Header.Set("Content-Type", "application/octet-stream")
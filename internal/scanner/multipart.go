@@ -0,0 +1,204 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+var errSessionGone = errors.New("upload session gone")
+
+// session is what the agent remembers about an in-flight multipart upload so
+// a restart can resume it. It is only reused while the file is unchanged.
+type session struct {
+	ID      string `json:"id"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+}
+
+type remotePart struct {
+	Number int    `json:"number"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func (a *Agent) sendMultipart(path string, f *os.File, st os.FileInfo, date, virtualPath string) error {
+	partSize := a.PartSize
+	if partSize <= 0 {
+		partSize = 64 << 20
+	}
+	sess, ok := a.loadSession(path)
+	if ok && (sess.Size != st.Size() || sess.ModTime != st.ModTime().Unix()) {
+		a.abortSession(sess.ID)
+		ok = false
+	}
+	var done map[int]string
+	if ok {
+		parts, err := a.sessionParts(sess.ID)
+		if err != nil && !errors.Is(err, errSessionGone) {
+			return err
+		}
+		ok = err == nil
+		done = parts
+	}
+	if !ok {
+		id, err := a.createSession(date, virtualPath)
+		if err != nil {
+			return err
+		}
+		sess = session{ID: id, Size: st.Size(), ModTime: st.ModTime().Unix()}
+		if err := a.saveSession(path, sess); err != nil {
+			return err
+		}
+	} else {
+		a.Log.Info("resuming upload", zap.String("path", path), zap.Int("parts_done", len(done)))
+	}
+
+	whole := sha256.New()
+	buf := make([]byte, partSize)
+	for n := 1; ; n++ {
+		read, err := io.ReadFull(f, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("read part %d: %w", n, err)
+		}
+		chunk := buf[:read]
+		whole.Write(chunk)
+		sum := sha256.Sum256(chunk)
+		digest := hex.EncodeToString(sum[:])
+		if done[n] != digest {
+			if err := a.putPart(sess.ID, n, chunk, digest); err != nil {
+				return err
+			}
+		}
+		if read < len(buf) {
+			break
+		}
+	}
+	if err := a.completeSession(sess.ID, hex.EncodeToString(whole.Sum(nil))); err != nil {
+		return err
+	}
+	return a.forgetSession(path)
+}
+
+func (a *Agent) createSession(date, virtualPath string) (string, error) {
+	q := url.Values{"date": {date}, "path": {virtualPath}}
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := a.call(http.MethodPost, "/v1/uploads?"+q.Encode(), nil, "", &out); err != nil {
+		return "", fmt.Errorf("create upload session: %w", err)
+	}
+	return out.ID, nil
+}
+
+func (a *Agent) sessionParts(id string) (map[int]string, error) {
+	var out struct {
+		Parts []remotePart `json:"parts"`
+	}
+	if err := a.call(http.MethodGet, "/v1/uploads/"+id, nil, "", &out); err != nil {
+		return nil, fmt.Errorf("upload session status: %w", err)
+	}
+	parts := make(map[int]string, len(out.Parts))
+	for _, p := range out.Parts {
+		parts[p.Number] = p.SHA256
+	}
+	return parts, nil
+}
+
+func (a *Agent) putPart(id string, n int, chunk []byte, digest string) error {
+	if err := a.call(http.MethodPut, fmt.Sprintf("/v1/uploads/%s/parts/%d", id, n), chunk, digest, nil); err != nil {
+		return fmt.Errorf("upload part %d: %w", n, err)
+	}
+	return nil
+}
+
+func (a *Agent) completeSession(id, digest string) error {
+	body, _ := json.Marshal(map[string]string{"sha256": digest})
+	if err := a.call(http.MethodPost, "/v1/uploads/"+id+"/complete", body, "", nil); err != nil {
+		return fmt.Errorf("complete upload: %w", err)
+	}
+	return nil
+}
+
+func (a *Agent) abortSession(id string) {
+	if err := a.call(http.MethodDelete, "/v1/uploads/"+id, nil, "", nil); err != nil && !errors.Is(err, errSessionGone) {
+		a.Log.Warn("abort upload session", zap.String("id", id), zap.Error(err))
+	}
+}
+
+func (a *Agent) call(method, path string, body []byte, digest string, out any) error {
+	req, _ := http.NewRequest(method, a.APIBaseURL+path, bytes.NewReader(body))
+	req.Header.Set("X-API-Key", a.APIKey)
+	if digest != "" {
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("X-Checksum-SHA256", digest)
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errSessionGone
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: %s", method, path, bytes.TrimSpace(b))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (a *Agent) loadSession(path string) (session, bool) {
+	var sess session
+	var ok bool
+	_ = a.DB.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("sessions"))
+		if b == nil {
+			return nil
+		}
+		if raw := b.Get([]byte(path)); raw != nil {
+			ok = json.Unmarshal(raw, &sess) == nil
+		}
+		return nil
+	})
+	return sess, ok
+}
+
+func (a *Agent) saveSession(path string, sess session) error {
+	raw, _ := json.Marshal(sess)
+	return a.DB.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("sessions"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(path), raw)
+	})
+}
+
+func (a *Agent) forgetSession(path string) error {
+	return a.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("sessions"))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(path))
+	})
+}
@@ -0,0 +1,184 @@
+package verifier
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/decompress"
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/example/fuses3redispostgres/internal/s3io"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	resultOK       = "ok"
+	resultMismatch = "mismatch"
+	resultMissing  = "missing"
+	resultError    = "error"
+)
+
+var (
+	objectsVerified = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "verifier_objects_total",
+		Help: "Objects checked by the integrity verifier, by result.",
+	}, []string{"result"})
+	bytesVerified = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "verifier_bytes_total",
+		Help: "Bytes re-read from storage by the integrity verifier.",
+	})
+	lastPass = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "verifier_last_pass_timestamp_seconds",
+		Help: "Unix time the last verification pass finished.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(objectsVerified, bytesVerified, lastPass)
+}
+
+// Verifier re-reads active objects from storage and compares them with the
+// recorded SHA-256. Objects are re-checked once their last verification is
+// older than MaxAge; mismatched or missing objects are marked corrupt.
+type Verifier struct {
+	Repo     Repo
+	Resolver *metadata.Resolver
+	Reader   Opener
+	Log      *zap.Logger
+	MaxAge   time.Duration
+	Batch    int
+}
+
+// Repo is the part of metadata.Repository the verifier uses.
+type Repo interface {
+	ListUnverified(ctx context.Context, verifiedBefore time.Time, after *metadata.VerifyCandidate, limit int) ([]metadata.VerifyCandidate, error)
+	MarkVerified(ctx context.Context, id int64, datePartition time.Time) error
+	MarkCorrupt(ctx context.Context, id int64, datePartition time.Time) (bool, error)
+}
+
+// Opener streams a byte range of an object, like s3io.Reader.Open.
+type Opener interface {
+	Open(ctx context.Context, bucket, key, versionID, etag string, start, end int64) (io.ReadCloser, error)
+}
+
+func (v *Verifier) Run(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		if n, err := v.RunOnce(ctx); err != nil {
+			v.Log.Error("verify pass failed", zap.Error(err))
+		} else if n > 0 {
+			v.Log.Info("verified objects", zap.Int("count", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// RunOnce verifies batches until nothing is due and returns how many objects
+// were checked. Each batch continues behind the previous one, so objects
+// that fail with an error are retried on the next pass rather than
+// re-selected in this one.
+func (v *Verifier) RunOnce(ctx context.Context) (int, error) {
+	batch := v.Batch
+	if batch <= 0 {
+		batch = 100
+	}
+	cutoff := time.Now().Add(-v.MaxAge)
+	checked := 0
+	var after *metadata.VerifyCandidate
+	for {
+		candidates, err := v.Repo.ListUnverified(ctx, cutoff, after, batch)
+		if err != nil {
+			return checked, err
+		}
+		for _, c := range candidates {
+			result := v.verify(ctx, c)
+			objectsVerified.WithLabelValues(result).Inc()
+			if result != resultError {
+				checked++
+			}
+			if ctx.Err() != nil {
+				return checked, ctx.Err()
+			}
+		}
+		if len(candidates) < batch {
+			lastPass.SetToCurrentTime()
+			return checked, nil
+		}
+		after = &candidates[len(candidates)-1]
+	}
+}
+
+func (v *Verifier) verify(ctx context.Context, c metadata.VerifyCandidate) string {
+	log := v.Log.With(zap.String("path", c.VirtualPath), zap.String("bucket", c.Bucket), zap.String("key", c.Key))
+	actual, n, err := v.digest(ctx, c.Object)
+	switch {
+	case errors.Is(err, s3io.ErrNotExist):
+		log.Warn("object missing from storage")
+		return v.markCorrupt(ctx, c, resultMissing)
+	case err != nil:
+		log.Warn("verify object", zap.Error(err))
+		return resultError
+	}
+	bytesVerified.Add(float64(n))
+	if n != c.LogicalSize() || actual != *c.ChecksumSHA {
+		log.Warn("checksum mismatch", zap.String("expected", *c.ChecksumSHA), zap.String("actual", actual), zap.Int64("size", n))
+		return v.markCorrupt(ctx, c, resultMismatch)
+	}
+	if err := v.Repo.MarkVerified(ctx, c.ID, c.DatePartition); err != nil {
+		log.Warn("record verification", zap.Error(err))
+		return resultError
+	}
+	return resultOK
+}
+
+func (v *Verifier) markCorrupt(ctx context.Context, c metadata.VerifyCandidate, result string) string {
+	changed, err := v.Repo.MarkCorrupt(ctx, c.ID, c.DatePartition)
+	if err != nil {
+		v.Log.Error("mark corrupt", zap.String("path", c.VirtualPath), zap.Error(err))
+		return resultError
+	}
+	if changed && v.Resolver != nil {
+		if err := v.Resolver.Invalidate(ctx, c.VirtualPath, []time.Time{c.DatePartition}); err != nil {
+			v.Log.Warn("invalidate resolver cache", zap.String("path", c.VirtualPath), zap.Error(err))
+		}
+	}
+	return result
+}
+
+// digest hashes the content as uploaded, decoding objects that were
+// compressed on ingest.
+func (v *Verifier) digest(ctx context.Context, obj metadata.Object) (string, int64, error) {
+	h := sha256.New()
+	if obj.Size == 0 {
+		return hex.EncodeToString(h.Sum(nil)), 0, nil
+	}
+	body, err := v.Reader.Open(ctx, obj.Bucket, obj.Key, obj.Version(), obj.ETag, 0, obj.Size-1)
+	if err != nil {
+		return "", 0, err
+	}
+	defer body.Close()
+	var content io.Reader = body
+	if obj.Codec != "" {
+		dec, err := decompress.NewStreamReader(decompress.Codec(obj.Codec), body)
+		if err != nil {
+			return "", 0, err
+		}
+		defer dec.Close()
+		content = dec
+	}
+	n, err := io.Copy(h, content)
+	if err != nil {
+		return "", n, fmt.Errorf("read object: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
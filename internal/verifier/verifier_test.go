@@ -0,0 +1,104 @@
+package verifier
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/fuses3redispostgres/internal/metadata"
+	"github.com/example/fuses3redispostgres/internal/s3io"
+	"go.uber.org/zap"
+)
+
+type memRepo struct {
+	rows     []metadata.VerifyCandidate
+	verified map[int64]bool
+	corrupt  map[int64]bool
+}
+
+func (m *memRepo) ListUnverified(_ context.Context, _ time.Time, after *metadata.VerifyCandidate, limit int) ([]metadata.VerifyCandidate, error) {
+	var out []metadata.VerifyCandidate
+	for _, c := range m.rows {
+		if m.verified[c.ID] || m.corrupt[c.ID] || (after != nil && c.ID <= after.ID) {
+			continue
+		}
+		if len(out) == limit {
+			break
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func (m *memRepo) MarkVerified(_ context.Context, id int64, _ time.Time) error {
+	m.verified[id] = true
+	return nil
+}
+
+func (m *memRepo) MarkCorrupt(_ context.Context, id int64, _ time.Time) (bool, error) {
+	changed := !m.corrupt[id]
+	m.corrupt[id] = true
+	return changed, nil
+}
+
+type memStore struct {
+	objects map[string]string
+	errs    map[string]error
+	opens   map[string]int
+}
+
+func (m *memStore) Open(_ context.Context, _, key, _, _ string, start, end int64) (io.ReadCloser, error) {
+	m.opens[key]++
+	if err := m.errs[key]; err != nil {
+		return nil, err
+	}
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, s3io.ErrNotExist
+	}
+	return io.NopCloser(strings.NewReader(data[start : end+1])), nil
+}
+
+func candidate(id int64, key, content string) metadata.VerifyCandidate {
+	sum := sha256.Sum256([]byte(content))
+	digest := hex.EncodeToString(sum[:])
+	return metadata.VerifyCandidate{ID: id, Object: metadata.Object{VirtualPath: "/" + key, Bucket: "b", Key: key, Size: int64(len(content)), ChecksumSHA: &digest}}
+}
+
+func TestRunOnceMarksResultsAndSkipsErrors(t *testing.T) {
+	repo := &memRepo{verified: map[int64]bool{}, corrupt: map[int64]bool{}}
+	repo.rows = []metadata.VerifyCandidate{
+		candidate(1, "flaky", "flaky"),
+		candidate(2, "good", "good"),
+		candidate(3, "changed", "original"),
+		candidate(4, "gone", "gone"),
+		candidate(5, "also-good", "also good"),
+	}
+	store := &memStore{
+		objects: map[string]string{"flaky": "flaky", "good": "good", "changed": "modified", "also-good": "also good"},
+		errs:    map[string]error{"flaky": errors.New("connection reset")},
+		opens:   map[string]int{},
+	}
+	v := &Verifier{Repo: repo, Reader: store, Log: zap.NewNop(), MaxAge: time.Hour, Batch: 2}
+	n, err := v.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatalf("checked %d objects, want 4", n)
+	}
+	if !repo.verified[2] || !repo.verified[5] || len(repo.verified) != 2 {
+		t.Fatalf("verified %v, want 2 and 5", repo.verified)
+	}
+	if !repo.corrupt[3] || !repo.corrupt[4] || len(repo.corrupt) != 2 {
+		t.Fatalf("corrupt %v, want 3 and 4", repo.corrupt)
+	}
+	if store.opens["flaky"] != 1 {
+		t.Fatalf("failing object read %d times in one pass, want 1", store.opens["flaky"])
+	}
+}
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_objects_virtual_path;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_objects_virtual_path ON objects ((virtual_path COLLATE "C"), date_partition DESC);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS directories;
+DROP INDEX IF EXISTS idx_objects_parent_filename;
+ALTER TABLE objects DROP COLUMN IF EXISTS parent_path_hash;
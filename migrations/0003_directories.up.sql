@@ -0,0 +1,29 @@
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS parent_path_hash CHAR(64);
+
+UPDATE objects
+SET parent_path_hash = encode(sha256(convert_to(COALESCE(NULLIF(regexp_replace(virtual_path, '/[^/]*$', ''), ''), '/'), 'UTF8')), 'hex')
+WHERE parent_path_hash IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_objects_parent_filename ON objects (parent_path_hash, (filename COLLATE "C"), date_partition DESC);
+
+CREATE TABLE IF NOT EXISTS directories (
+  path_hash CHAR(64) PRIMARY KEY,
+  path TEXT NOT NULL,
+  parent_path_hash CHAR(64),
+  name TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_directories_parent_name ON directories (parent_path_hash, (name COLLATE "C"));
+
+INSERT INTO directories (path_hash, path, parent_path_hash, name)
+SELECT encode(sha256(convert_to(d.path, 'UTF8')), 'hex'),
+  d.path,
+  CASE WHEN d.path = '/' THEN NULL
+    ELSE encode(sha256(convert_to(COALESCE(NULLIF(regexp_replace(d.path, '/[^/]*$', ''), ''), '/'), 'UTF8')), 'hex') END,
+  CASE WHEN d.path = '/' THEN '' ELSE regexp_replace(d.path, '^.*/', '') END
+FROM (
+  SELECT DISTINCT '/' || array_to_string((string_to_array(ltrim(virtual_path, '/'), '/'))[1:n], '/') AS path
+  FROM objects, generate_series(0, array_length(string_to_array(ltrim(virtual_path, '/'), '/'), 1) - 1) AS n
+) d
+ON CONFLICT (path_hash) DO NOTHING;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_objects_deleted;
+ALTER TABLE objects DROP COLUMN IF EXISTS status_changed_at;
@@ -0,0 +1,3 @@
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_objects_deleted ON objects (status_changed_at) WHERE status = 'deleted';
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_objects_path_versions;
+
+DELETE FROM objects o USING objects n
+WHERE o.date_partition = n.date_partition AND o.path_hash = n.path_hash AND o.filename_hash = n.filename_hash AND o.id < n.id;
+
+ALTER TABLE objects ADD CONSTRAINT objects_date_partition_path_hash_filename_hash_key UNIQUE (date_partition, path_hash, filename_hash);
@@ -0,0 +1,3 @@
+ALTER TABLE objects DROP CONSTRAINT IF EXISTS objects_date_partition_path_hash_filename_hash_key;
+
+CREATE INDEX IF NOT EXISTS idx_objects_path_versions ON objects (path_hash, filename_hash, id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_objects_bucket_key;
+DROP INDEX IF EXISTS idx_objects_sha256_size;
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_objects_sha256_size ON objects (checksum_sha256, size) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_objects_bucket_key ON objects (bucket, key);
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_objects_verify ON objects (verified_at NULLS FIRST, date_partition, id)
+  WHERE status = 'active' AND checksum_sha256 IS NOT NULL;
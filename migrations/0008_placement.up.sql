@@ -0,0 +1 @@
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS placement_policy TEXT;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS decompress_index (
+  bucket TEXT NOT NULL,
+  key TEXT NOT NULL,
+  etag TEXT NOT NULL,
+  codec TEXT NOT NULL,
+  decompressed_size BIGINT NOT NULL,
+  points BYTEA NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (bucket, key, etag, codec)
+);
@@ -0,0 +1 @@
+ALTER TABLE objects DROP COLUMN IF EXISTS codec, DROP COLUMN IF EXISTS original_size;
@@ -0,0 +1 @@
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS codec TEXT, ADD COLUMN IF NOT EXISTS original_size BIGINT;